@@ -41,6 +41,11 @@ var (
 	schemaFile         = flag.String("schema-file", "", "schema-file")
 	loadServerDataFlag = flag.Bool("load-server-data", false, "load-server-data")
 	pidfile            = flag.String("pid-file", "", "Name of file that will hold the pid")
+	migrateDataFlag    = flag.Bool("migrate-data", false, "Rewrite the rows stored by older versions of the server")
+	validators         = flag.String("validators", "", "Registered transaction validators to enable, separated by ','")
+	notificationQueue  = flag.Int("notification-queue-length", ovsdb.NotificationQueueLength, "Maximum number of pending notifications of a monitor")
+	notificationRows   = flag.Int("notification-queue-rows", ovsdb.NotificationQueueRows, "Maximum number of pending row updates of a monitor")
+	slowConsumer       = flag.String("slow-consumer-policy", ovsdb.SLOW_CONSUMER_CANCEL, "Policy of a monitor that exceeds its notification queue limits, 'cancel' or 'resync'")
 )
 
 var GitCommit string
@@ -58,7 +63,8 @@ func main() {
 		etcdMembers, "schema-basedir", schemaBasedir, "max-tasks", maxTasks,
 		"database-prefix", databasePrefix, "service-name", serviceName,
 		"schema-file", schemaFile, "load-server-data-flag", loadServerDataFlag,
-		"pidfile", pidfile)
+		"pidfile", pidfile, "validators", validators, "notification-queue-length", notificationQueue,
+		"notification-queue-rows", notificationRows, "slow-consumer-policy", slowConsumer)
 
 	if len(*tcpAddress) == 0 && len(*unixAddress) == 0 {
 		log.Info("You must provide a network-address (TCP and/or UNIX) to listen on")
@@ -73,6 +79,23 @@ func main() {
 		log.Info("Illegal serviceName %s", *serviceName)
 		os.Exit(1)
 	}
+	if len(*validators) > 0 {
+		if err := ovsdb.EnableTransactionValidators(strings.Split(*validators, ",")); err != nil {
+			log.Error(err, "failed to enable transaction validators")
+			os.Exit(1)
+		}
+	}
+
+	if *notificationQueue <= 0 || *notificationRows <= 0 {
+		log.Info("Illegal notification queue limits", "length", *notificationQueue, "rows", *notificationRows)
+		os.Exit(1)
+	}
+	ovsdb.NotificationQueueLength = *notificationQueue
+	ovsdb.NotificationQueueRows = *notificationRows
+	if err := ovsdb.SetSlowConsumerPolicy(*slowConsumer); err != nil {
+		log.Error(err, "failed to set the slow consumer policy")
+		os.Exit(1)
+	}
 
 	if *pidfile != "" {
 		defer delPidfile(*pidfile)
@@ -111,6 +134,14 @@ func main() {
 		log.Error(err, "failed to add schema")
 		os.Exit(1)
 	}
+	if *migrateDataFlag {
+		migrated, err := db.(*ovsdb.DatabaseEtcd).MigrateData(context.Background())
+		if err != nil {
+			log.Error(err, "failed to migrate data")
+			os.Exit(1)
+		}
+		log.Info("migrated data", "rows", migrated)
+	}
 	// TODO for development only, will be remove later
 	if *loadServerDataFlag {
 		err = loadServerData(db.(*ovsdb.DatabaseEtcd))
@@ -133,6 +164,9 @@ func main() {
 		cancel()
 	}()
 
+	// reset the ephemeral columns of the servers that are down
+	go db.GetEphemeralOwner().Run(ctx)
+
 	servOptions := &jrpc2.ServerOptions{
 		Concurrency: *maxTasks,
 		Metrics:     metrics.New(),
@@ -215,6 +249,9 @@ func createServicesMap(sharedService *ovsdb.Service, clientHandler *ovsdb.Handle
 	handlerMap["convert"] = handler.New(sharedService.Convert)
 
 	handlerMap["transact"] = handler.New(clientHandler.Transact)
+	handlerMap["transact_dry_run"] = handler.New(clientHandler.TransactDryRun)
+	handlerMap["row_history"] = handler.New(clientHandler.RowHistory)
+	handlerMap["revert"] = handler.New(clientHandler.Revert)
 	handlerMap["cancel"] = handler.New(clientHandler.Cancel)
 	handlerMap["monitor"] = handler.New(clientHandler.Monitor)
 	handlerMap["monitor_cancel"] = handler.New(clientHandler.MonitorCancel)
@@ -4,17 +4,12 @@ import (
 	"context"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/ibm/ovsdb-etcd/pkg/common"
 	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
 	"github.com/ibm/ovsdb-etcd/pkg/ovsdb"
 	"github.com/ibm/ovsdb-etcd/pkg/types/OVN_Northbound"
 )
 
-func newUUID() libovsdb.UUID {
-	return common.ToUUID(uuid.NewString())
-}
-
 func newSet(s interface{}) (*libovsdb.OvsSet, error) {
 	set, err := libovsdb.NewOvsSet(s)
 	if err != nil {
@@ -54,7 +49,6 @@ func putNbGlobalOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid string
 		Sb_cfg:           0,
 		Sb_cfg_timestamp: 0,
 		Ssl:              libovsdb.OvsSet{},
-		Version:          newUUID(),
 		Uuid:             libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "NB_Global", uuid), nbGlobal)
@@ -72,7 +66,6 @@ func putAclOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid string, act
 		Name:         libovsdb.OvsSet{},
 		Priority:     priority,
 		Severity:     libovsdb.OvsSet{},
-		Version:      newUUID(),
 		Uuid:         libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "ACL", uuid), acl)
@@ -92,7 +85,6 @@ func putAddressSetOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid stri
 		Addresses:    *addressesSet,
 		External_ids: *externalIdsMap,
 		Name:         name,
-		Version:      newUUID(),
 		Uuid:         libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Address_Set", uuid), addressSet)
@@ -112,7 +104,6 @@ func putConnectionOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid stri
 		Other_config:     libovsdb.OvsMap{},
 		Status:           *statusMap,
 		Target:           target,
-		Version:          newUUID(),
 		Uuid:             libovsdb.UUID{GoUUID: uuid},
 	}
 
@@ -137,7 +128,6 @@ func putForwardingGroupOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid
 		Name:         name,
 		Vip:          "",
 		Vmac:         "",
-		Version:      newUUID(),
 		Uuid:         libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Forwarding_Group", uuid), fowardingGroup)
@@ -170,7 +160,6 @@ func putloadBalancerOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid st
 		Protocol:         *protocolSet,
 		Selection_fields: libovsdb.OvsSet{},
 		Vips:             *vipsMap,
-		Version:          newUUID(),
 		Uuid:             libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Load_Balancer", uuid), loadBalancer)
@@ -204,7 +193,6 @@ func putlogicalRouterOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid s
 		Policies:      libovsdb.OvsSet{},
 		Ports:         *portsSet,
 		Static_routes: *staticRoutesSet,
-		Version:       newUUID(),
 		Uuid:          common.ToUUID(uuid),
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Logical_Router", uuid), logicalRouter)
@@ -222,7 +210,6 @@ func putGatewayChassisOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid
 		Name:         name,
 		Options:      libovsdb.OvsMap{},
 		Priority:     priority,
-		Version:      newUUID(),
 		Uuid:         libovsdb.UUID{GoUUID: uuid},
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Gateway_Chassis", uuid), gatewayChassis)
@@ -249,7 +236,6 @@ func putlogicalSwitchOnEtcd(ctx context.Context, con *ovsdb.DatabaseEtcd, uuid s
 		Other_config:      libovsdb.OvsMap{},
 		Ports:             *portsSet,
 		Qos_rules:         libovsdb.OvsSet{},
-		Version:           newUUID(),
 		Uuid:              common.ToUUID(uuid),
 	}
 	con.PutData(ctx, common.NewDataKey("OVN_Northbound", "Logical_Switch", uuid), logicalSwitch)
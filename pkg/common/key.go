@@ -11,6 +11,9 @@ const (
 	KEY_DELIMETER = "/"
 	LOCKS         = "_locks"
 	COMMENTS      = "_comments"
+	DELETIONS     = "_deletions"
+	EPHEMERALS    = "_ephemerals"
+	TRANSACTIONS  = "_transactions"
 	INTERNAL_DB   = "_"
 )
 
@@ -110,6 +113,28 @@ func NewLockKey(lockID string) Key {
 	return NewDataKey(INTERNAL_DB, LOCKS, lockID)
 }
 
+// Returns a new Deletion key, the key is modified by every transaction that deletes rows of the given table.
+func NewDeletionKey(dbName, tableName string) Key {
+	return NewDataKey(INTERNAL_DB, DELETIONS, dbName+"."+tableName)
+}
+
+// Returns a new Ephemeral key, the key exists while the ephemeral columns of the given row are owned by a server.
+// If the given uuid is an empty string, the return key is the prefix of the ephemeral keys of the table.
+func NewEphemeralKey(dbName, tableName, uuid string) Key {
+	return NewDataKey(INTERNAL_DB, EPHEMERALS, dbName+"."+tableName+"."+uuid)
+}
+
+// Returns the Transaction key, the key is modified by every transaction that modifies the data. Its value is the record
+// of the last transaction, so its history is the log of the transactions.
+func NewTransactionKey() Key {
+	return NewDataKey(INTERNAL_DB, TRANSACTIONS, "last")
+}
+
+// Helper function, which returns a key to the Ephemerals table
+func NewEphemeralTableKey() Key {
+	return NewDataKey(INTERNAL_DB, EPHEMERALS, "")
+}
+
 // Helper function, which returns a key to entire table
 func NewTableKey(dbName, tableName string) Key {
 	return NewDataKey(dbName, tableName, "")
@@ -21,6 +21,8 @@ type Operation struct {
 	UUID      *UUID                     `json:"uuid,omitempty"`
 	Comment   *string                   `json:"comment,omitempty"`
 	Durable   *bool                     `json:"durable,omitempty"`
+	Lock      *string                   `json:"lock,omitempty"`
+	Revision  *int64                    `json:"revision,omitempty"`
 }
 
 // String, serialize Transact
@@ -35,8 +37,13 @@ func (o Operation) String() string {
 // MarshalJSON marshalls 'Operation' to a byte array
 // For 'select' operations, we dont omit the 'Where' field
 // to allow selecting all rows of a table
+// The 'UUID' field of 'insert' operations is marshalled as a plain string, as ovsdb-server expects it
 func (o Operation) MarshalJSON() ([]byte, error) {
 	type OpAlias Operation
+	var uuid *string
+	if o.UUID != nil {
+		uuid = &o.UUID.GoUUID
+	}
 	switch o.Op {
 	case "select":
 		where := o.Where
@@ -46,20 +53,51 @@ func (o Operation) MarshalJSON() ([]byte, error) {
 		}
 		return json.Marshal(&struct {
 			Where *[]interface{} `json:"where,omitempty"`
+			UUID  *string        `json:"uuid,omitempty"`
 			OpAlias
 		}{
 			Where:   where,
+			UUID:    uuid,
 			OpAlias: (OpAlias)(o),
 		})
 	default:
 		return json.Marshal(&struct {
+			UUID *string `json:"uuid,omitempty"`
 			OpAlias
 		}{
+			UUID:    uuid,
 			OpAlias: (OpAlias)(o),
 		})
 	}
 }
 
+// UnmarshalJSON unmarshalls a byte array to an 'Operation'
+// The 'UUID' field of 'insert' operations is a plain string, as ovsdb-server expects it, the RFC 7047 notation of a
+// uuid is accepted as well
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	type OpAlias Operation
+	op := struct {
+		UUID json.RawMessage `json:"uuid,omitempty"`
+		*OpAlias
+	}{
+		OpAlias: (*OpAlias)(o),
+	}
+	if err := json.Unmarshal(data, &op); err != nil {
+		return err
+	}
+	if len(op.UUID) == 0 || string(op.UUID) == "null" {
+		o.UUID = nil
+		return nil
+	}
+	var uuid string
+	if err := json.Unmarshal(op.UUID, &uuid); err == nil {
+		o.UUID = &UUID{GoUUID: uuid}
+		return nil
+	}
+	o.UUID = &UUID{}
+	return json.Unmarshal(op.UUID, o.UUID)
+}
+
 // MonitorRequests represents a group of monitor requests according to RFC7047
 // We cannot use MonitorRequests by inlining the MonitorRequest Map structure till GoLang issue #6213 makes it.
 // The only option is to go with raw map[string]interface{} option :-( that sucks !
@@ -176,11 +214,12 @@ type TransactResponse struct {
 
 // OperationResult is the result of an Operation
 type OperationResult struct {
-	Count   *int         `json:"count,omitempty"`
-	Error   *string      `json:"error,omitempty"`
-	Details *string      `json:"details,omitempty"`
-	UUID    *UUID        `json:"uuid,omitempty"`
-	Rows    *[]ResultRow `json:"rows,omitempty"`
+	Count    *int         `json:"count,omitempty"`
+	Error    *string      `json:"error,omitempty"`
+	Details  *string      `json:"details,omitempty"`
+	UUID     *UUID        `json:"uuid,omitempty"`
+	Rows     *[]ResultRow `json:"rows,omitempty"`
+	Revision *int64       `json:"revision,omitempty"`
 }
 
 func (res *OperationResult) SetError(err string) {
@@ -188,6 +227,7 @@ func (res *OperationResult) SetError(err string) {
 	res.Count = nil
 	res.UUID = nil
 	res.Rows = nil
+	res.Revision = nil
 }
 
 // String, serialize TransactResponse
@@ -177,3 +177,47 @@ func TestNewMutation(t *testing.T) {
 		t.Error("mutation is not correctly formatted")
 	}
 }
+
+func TestOpUUIDSerialization(t *testing.T) {
+	table := "Bridge"
+	operation := Operation{
+		Op:    "insert",
+		Table: &table,
+		UUID:  &UUID{"550e8400-e29b-41d4-a716-446655440000"},
+	}
+	str, err := json.Marshal(operation)
+	if err != nil {
+		log.Fatal("serialization error:", err)
+	}
+	expected := `{"uuid":"550e8400-e29b-41d4-a716-446655440000","op":"insert","table":"Bridge"}`
+	if string(str) != expected {
+		t.Error("Expected: ", expected, "Got", string(str))
+	}
+
+	var op Operation
+	if err = json.Unmarshal(str, &op); err != nil {
+		t.Error("deserialization error:", err)
+	}
+	if op.UUID == nil || *op.UUID != *operation.UUID {
+		t.Error("Expected: ", *operation.UUID, "Got", op.UUID)
+	}
+
+	/* other uuids have the RFC 7047 notation only */
+	var uuid UUID
+	if err = json.Unmarshal([]byte(`"550e8400-e29b-41d4-a716-446655440000"`), &uuid); err == nil {
+		t.Error("Expected error, Got", uuid)
+	}
+	if err = json.Unmarshal([]byte(`["uuid"]`), &uuid); err == nil {
+		t.Error("Expected error, Got", uuid)
+	}
+
+	/* the RFC 7047 notation is accepted as well */
+	str = []byte(`{"op":"insert","table":"Bridge","uuid":["uuid","550e8400-e29b-41d4-a716-446655440000"]}`)
+	op = Operation{}
+	if err = json.Unmarshal(str, &op); err != nil {
+		t.Error("deserialization error:", err)
+	}
+	if op.UUID == nil || *op.UUID != *operation.UUID {
+		t.Error("Expected: ", *operation.UUID, "Got", op.UUID)
+	}
+}
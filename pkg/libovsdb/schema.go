@@ -6,7 +6,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 type Schemas map[string]*DatabaseSchema
@@ -38,8 +40,16 @@ func (schemas *Schemas) AddFromBytes(data []byte) error {
 	return nil
 }
 
+// Add adds a copy of the database schema with the names of its tables, the given schema is not modified because it
+// can be shared by concurrent transactions
 func (schemas *Schemas) Add(databaseSchema *DatabaseSchema) {
-	(*schemas)[databaseSchema.Name] = databaseSchema
+	schema := *databaseSchema
+	schema.Tables = make(map[string]TableSchema, len(databaseSchema.Tables))
+	for name, tableSchema := range databaseSchema.Tables {
+		tableSchema.Name = name
+		schema.Tables[name] = tableSchema
+	}
+	(*schemas)[schema.Name] = &schema
 }
 
 // DatabaseSchema is a database schema according to RFC7047
@@ -124,6 +134,7 @@ func (schema *DatabaseSchema) String() string {
 
 // TableSchema is a table schema according to RFC7047
 type TableSchema struct {
+	Name    string                   `json:"-"`
 	Columns map[string]*ColumnSchema `json:"columns"`
 	Indexes [][]string               `json:"indexes,omitempty"`
 	MaxRows int                      `json:"maxRows,omitempty"`
@@ -212,15 +223,16 @@ type BaseType struct {
 	// Enum will be parsed manually and set to a slice
 	// of possible values. They must be type-asserted to the
 	// corret type depending on the Type field
-	Enum       *OvsSet `json:"enum,omitempty"`
-	MinReal    float64 `json:"minReal,omitempty"`
-	MaxReal    float64 `json:"maxReal,omitempty"`
-	MinInteger int     `json:"minInteger,omitempty"`
-	MaxInteger int     `json:"maxInteger,omitempty"`
-	MinLength  int     `json:"minLength,omitempty"` /* string */
-	MaxLength  int     `json:"maxLength,omitempty"` /* string */
-	RefTable   string  `json:"refTable,omitempty"`  /* UUIDs */
-	RefType    RefType `json:"refType,omitempty"`
+	Enum *OvsSet `json:"enum,omitempty"`
+	// the bounds are nil if they are not defined by the schema
+	MinReal    *float64 `json:"minReal,omitempty"`
+	MaxReal    *float64 `json:"maxReal,omitempty"`
+	MinInteger *int     `json:"minInteger,omitempty"`
+	MaxInteger *int     `json:"maxInteger,omitempty"`
+	MinLength  *int     `json:"minLength,omitempty"` /* string */
+	MaxLength  *int     `json:"maxLength,omitempty"` /* string */
+	RefTable   string   `json:"refTable,omitempty"`  /* UUIDs */
+	RefType    RefType  `json:"refType,omitempty"`
 }
 
 // String returns a string representation of the (native) column type
@@ -466,6 +478,18 @@ func (columnSchema *ColumnSchema) Default() interface{} {
 	}
 }
 
+// EphemeralColumns returns the sorted names of the ephemeral columns of the table
+func (tableSchema *TableSchema) EphemeralColumns() []string {
+	columns := []string{}
+	for column, columnSchema := range tableSchema.Columns {
+		if columnSchema.Ephemeral != nil && *columnSchema.Ephemeral {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
 func (tableSchema *TableSchema) Default(row *map[string]interface{}) {
 	for column, columnSchema := range tableSchema.Columns {
 		if _, ok := (*row)[column]; !ok {
@@ -665,7 +689,7 @@ func (tableSchema *TableSchema) Unmarshal(row *map[string]interface{}) error {
 				to, err = columnSchema.Unmarshal(value)
 			}
 			if err != nil {
-				return fmt.Errorf("[column %s] %s", column, err.Error())
+				return &ValidationError{Table: tableSchema.Name, Column: column, Value: value, Reason: err.Error()}
 			}
 			(*row)[column] = to
 		}
@@ -680,6 +704,10 @@ func (databaseSchema *DatabaseSchema) Unmarshal(table string, row *map[string]in
 	}
 	err := tableSchema.Unmarshal(row)
 	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Table = table
+			return vErr
+		}
 		return fmt.Errorf("[table %s] %s", table, err)
 	}
 	return nil
@@ -692,6 +720,10 @@ func (schemas *Schemas) Unmarshal(dbname, table string, row *map[string]interfac
 	}
 	err := databaseSchema.Unmarshal(table, row)
 	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Database = dbname
+			return vErr
+		}
 		return fmt.Errorf("[database %s] %s", dbname, err)
 	}
 	return nil
@@ -740,25 +772,57 @@ func (schemas *Schemas) LookupTable(dbname, table string) (*TableSchema, error)
 
 /* validate */
 func (baseType *BaseType) ValidateInteger(value interface{}) error {
-	_, ok := value.(int)
+	typeval, ok := value.(int)
 	if !ok {
 		return fmt.Errorf("expected integer: %+v", value)
 	}
-	return nil
+	if baseType.MinInteger != nil && typeval < *baseType.MinInteger {
+		return fmt.Errorf("integer %d is less than minimum allowed value %d", typeval, *baseType.MinInteger)
+	}
+	if baseType.MaxInteger != nil && typeval > *baseType.MaxInteger {
+		return fmt.Errorf("integer %d is greater than maximum allowed value %d", typeval, *baseType.MaxInteger)
+	}
+	return baseType.validateEnum(float64(typeval))
 }
 
 func (baseType *BaseType) ValidateReal(value interface{}) error {
-	_, ok := value.(float64)
+	typeval, ok := value.(float64)
 	if !ok {
-		return fmt.Errorf("expected integer: %+v", value)
+		return fmt.Errorf("expected real: %+v", value)
 	}
-	return nil
+	if baseType.MinReal != nil && typeval < *baseType.MinReal {
+		return fmt.Errorf("real %g is less than minimum allowed value %g", typeval, *baseType.MinReal)
+	}
+	if baseType.MaxReal != nil && typeval > *baseType.MaxReal {
+		return fmt.Errorf("real %g is greater than maximum allowed value %g", typeval, *baseType.MaxReal)
+	}
+	return baseType.validateEnum(typeval)
+}
+
+// validateEnum verifies that a number is one of the enum values, if the base type has an enum
+func (baseType *BaseType) validateEnum(value float64) error {
+	if baseType.Enum == nil {
+		return nil
+	}
+	for _, v := range baseType.Enum.GoSet {
+		switch enumval := v.(type) {
+		case float64:
+			if value == enumval {
+				return nil
+			}
+		case int:
+			if value == float64(enumval) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("enum value is not valid: %+v", value)
 }
 
 func (baseType *BaseType) ValidateBoolean(value interface{}) error {
 	_, ok := value.(bool)
 	if !ok {
-		return fmt.Errorf("expected integer: %+v", value)
+		return fmt.Errorf("expected boolean: %+v", value)
 	}
 	return nil
 }
@@ -766,7 +830,14 @@ func (baseType *BaseType) ValidateBoolean(value interface{}) error {
 func (baseType *BaseType) ValidateString(value interface{}) error {
 	typeval, ok := value.(string)
 	if !ok {
-		return fmt.Errorf("expected integer: %+v", value)
+		return fmt.Errorf("expected string: %+v", value)
+	}
+	length := utf8.RuneCountInString(typeval)
+	if baseType.MinLength != nil && length < *baseType.MinLength {
+		return fmt.Errorf("%q length %d is less than minimum allowed length %d", typeval, length, *baseType.MinLength)
+	}
+	if baseType.MaxLength != nil && length > *baseType.MaxLength {
+		return fmt.Errorf("%q length %d is greater than maximum allowed length %d", typeval, length, *baseType.MaxLength)
 	}
 	if baseType.Enum == nil {
 		return nil
@@ -789,14 +860,14 @@ func (baseType *BaseType) ValidateString(value interface{}) error {
 func (baseType *BaseType) ValidateUUID(value interface{}) error {
 	_, ok := value.(UUID)
 	if !ok {
-		return fmt.Errorf("expected integer: %+v", value)
+		return fmt.Errorf("expected uuid: %+v", value)
 	}
 	return nil
 }
 
 func (baseType *BaseType) Validate(value interface{}) error {
 	if baseType == nil {
-		panic(fmt.Sprintf("nil base type, value = %v", value))
+		return fmt.Errorf("nil base type, value = %v", value)
 	}
 	switch baseType.Type {
 	case TypeInteger:
@@ -810,7 +881,7 @@ func (baseType *BaseType) Validate(value interface{}) error {
 	case TypeUUID:
 		return baseType.ValidateUUID(value)
 	default:
-		panic(fmt.Sprintf("unsupported value type %s", baseType.Type))
+		return fmt.Errorf("unsupported value type %s", baseType.Type)
 	}
 }
 
@@ -819,6 +890,9 @@ func (columnSchema *ColumnSchema) ValidateInteger(value interface{}) error {
 	if !ok {
 		return fmt.Errorf("expected integer: %+v", value)
 	}
+	if columnSchema.TypeObj != nil && columnSchema.TypeObj.Key != nil {
+		return columnSchema.TypeObj.Key.ValidateInteger(value)
+	}
 	return nil
 }
 
@@ -827,6 +901,9 @@ func (columnSchema *ColumnSchema) ValidateReal(value interface{}) error {
 	if !ok {
 		return fmt.Errorf("expected real: %+v", value)
 	}
+	if columnSchema.TypeObj != nil && columnSchema.TypeObj.Key != nil {
+		return columnSchema.TypeObj.Key.ValidateReal(value)
+	}
 	return nil
 }
 
@@ -843,6 +920,9 @@ func (columnSchema *ColumnSchema) ValidateString(value interface{}) error {
 	if !ok {
 		return fmt.Errorf("expected string: %+v", value)
 	}
+	if columnSchema.TypeObj != nil && columnSchema.TypeObj.Key != nil {
+		return columnSchema.TypeObj.Key.ValidateString(value)
+	}
 	return nil
 }
 
@@ -911,7 +991,7 @@ func (columnSchema *ColumnSchema) ValidateMap(value interface{}) error {
 
 func (columnSchema *ColumnSchema) Validate(value interface{}) error {
 	if columnSchema == nil {
-		panic(fmt.Sprintf("nil column schema"))
+		return fmt.Errorf("nil column schema")
 	}
 	switch columnSchema.Type {
 	case TypeInteger:
@@ -938,10 +1018,29 @@ func (columnSchema *ColumnSchema) Validate(value interface{}) error {
 		}
 		return errMap
 	default:
-		panic(fmt.Sprintf("unsupported type %s", columnSchema.Type))
+		return fmt.Errorf("unsupported type %s", columnSchema.Type)
 	}
 }
 
+// ValidationError is returned when a row value doesn't comply with the schema of its column, or when the row contains
+// an unknown column
+type ValidationError struct {
+	Database string
+	Table    string
+	Column   string
+	Value    interface{}
+	Reason   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("[database %s] [table %s] [column %s] %s", e.Database, e.Table, e.Column, e.Reason)
+}
+
+// Details returns a human readable description of the error
+func (e *ValidationError) Details() string {
+	return fmt.Sprintf("Column %q of table %q: %s.", e.Column, e.Table, e.Reason)
+}
+
 func (tableSchema *TableSchema) Validate(row *map[string]interface{}) error {
 	for column, value := range *row {
 		if column == "_uuid" || column == "_version" {
@@ -949,11 +1048,11 @@ func (tableSchema *TableSchema) Validate(row *map[string]interface{}) error {
 		}
 		columnSchema, ok := tableSchema.Columns[column]
 		if !ok {
-			return fmt.Errorf("missing schema for column %s", column)
+			return &ValidationError{Table: tableSchema.Name, Column: column, Value: value, Reason: "unknown column"}
 		}
 		err := columnSchema.Validate(value)
 		if err != nil {
-			return fmt.Errorf("[column %s] %s", column, err.Error())
+			return &ValidationError{Table: tableSchema.Name, Column: column, Value: value, Reason: err.Error()}
 		}
 	}
 	return nil
@@ -966,6 +1065,10 @@ func (databaseSchema *DatabaseSchema) Validate(table string, row *map[string]int
 	}
 	err := tableSchema.Validate(row)
 	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Table = table
+			return vErr
+		}
 		return fmt.Errorf("[table %s] %s", table, err.Error())
 	}
 	return nil
@@ -978,6 +1081,10 @@ func (schemas *Schemas) Validate(dbname, table string, row *map[string]interface
 	}
 	err := databaseSchema.Validate(table, row)
 	if err != nil {
+		if vErr, ok := err.(*ValidationError); ok {
+			vErr.Database = dbname
+			return vErr
+		}
 		return fmt.Errorf("[database %s] %s", dbname, err.Error())
 	}
 	return nil
@@ -349,3 +349,51 @@ func TestSchema(t *testing.T) {
 	}
 
 }
+
+func TestSchemaValidateError(t *testing.T) {
+	schemas := Schemas{}
+	schemas.Add(&DatabaseSchema{
+		Name: "db",
+		Tables: map[string]TableSchema{
+			"table": {
+				Columns: map[string]*ColumnSchema{
+					"int": {
+						Type: TypeInteger,
+					},
+				},
+			},
+		},
+	})
+	for column, value := range map[string]interface{}{"int": "1", "unknown": 1} {
+		row := map[string]interface{}{column: value}
+		err := schemas.Validate("db", "table", &row)
+		vErr, ok := err.(*ValidationError)
+		if !ok {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+		if vErr.Database != "db" || vErr.Table != "table" || vErr.Column != column {
+			t.Errorf("unexpected validation error %+v", vErr)
+		}
+	}
+}
+
+func TestBaseTypeBounds(t *testing.T) {
+	var baseType BaseType
+	if err := json.Unmarshal([]byte(`{"type": "integer", "minInteger": 1, "maxInteger": 4094}`), &baseType); err != nil {
+		t.Fatal(err)
+	}
+	for value, valid := range map[int]bool{0: false, 1: true, 4094: true, 4095: false} {
+		if err := baseType.ValidateInteger(value); (err == nil) != valid {
+			t.Errorf("integer %d, expected valid %v, got %v", value, valid, err)
+		}
+	}
+	baseType = BaseType{}
+	if err := json.Unmarshal([]byte(`{"type": "string", "minLength": 1, "maxLength": 3}`), &baseType); err != nil {
+		t.Fatal(err)
+	}
+	for value, valid := range map[string]bool{"": false, "abc": true, "äöü": true, "abcd": false} {
+		if err := baseType.ValidateString(value); (err == nil) != valid {
+			t.Errorf("string %q, expected valid %v, got %v", value, valid, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package libovsdb
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 )
 
@@ -27,10 +28,14 @@ func (u UUID) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON will unmarshal a JSON encoded byte array to a OVSDB style UUID
 func (u *UUID) UnmarshalJSON(b []byte) (err error) {
 	var ovsUUID []string
-	if err := json.Unmarshal(b, &ovsUUID); err == nil {
-		u.GoUUID = ovsUUID[1]
+	if err := json.Unmarshal(b, &ovsUUID); err != nil {
+		return err
 	}
-	return err
+	if len(ovsUUID) != 2 {
+		return fmt.Errorf("wrong formatted uuid %s", string(b))
+	}
+	u.GoUUID = ovsUUID[1]
+	return nil
 }
 
 func (u UUID) ValidateUUID() error {
@@ -3,15 +3,20 @@ package ovsdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/ibm/ovsdb-etcd/pkg/types/_Server"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/klogr"
 
 	"github.com/ibm/ovsdb-etcd/pkg/common"
 	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
@@ -24,18 +29,20 @@ type Databaser interface {
 	GetSchemas() libovsdb.Schemas
 	GetKeyData(key common.Key, keysOnly bool) (*clientv3.GetResponse, error)
 	GetData(keys []common.Key) (*clientv3.TxnResponse, error)
+	GetDataAtRevision(keys []common.Key, revision int64) (*clientv3.TxnResponse, error)
 	PutData(ctx context.Context, key common.Key, obj interface{}) error
 	GetSchema(name string) map[string]interface{}
-	DbLock(dbName string)
-	DbUnlock(dbName string)
+	GetEphemeralOwner() *EphemeralOwner
 }
 
 type DatabaseEtcd struct {
 	cli        *clientv3.Client
 	Schemas    libovsdb.Schemas // dataBaseName -> schema
 	strSchemas map[string]map[string]interface{}
-	locks      map[string]*sync.Mutex
 	mu         sync.Mutex
+	ephemeral  *EphemeralOwner
+	// the watches of the databases that are shared by all the monitors, by the database names
+	watchers map[string]*dbWatcher
 }
 
 type Locker interface {
@@ -43,30 +50,130 @@ type Locker interface {
 	lock() error
 	unlock() error
 	cancel()
+	// isOwner returns false if the lock was not acquired, otherwise it returns the etcd comparisons that hold as long
+	// as the lock is owned, so the ownership can be verified atomically with an etcd transaction.
+	isOwner() ([]clientv3.Cmp, bool)
+	// steal acquires the lock, even if it is owned or requested by other clients
+	steal() error
+	// waitLost blocks while the lock is owned. It returns nil if the lock was lost, e.g. stolen by another client, and
+	// an error if the lock was released or canceled by its owner.
+	waitLost() error
 }
 
+var errLockReleased = errors.New("lock released")
+
 type lock struct {
 	mutex    *concurrency.Mutex
+	session  *concurrency.Session
+	cli      *clientv3.Client
+	prefix   string
 	myCancel context.CancelFunc
 	cntx     context.Context
+	mu       sync.Mutex
+	acquired bool
+}
+
+func (l *lock) setAcquired(acquired bool) {
+	l.mu.Lock()
+	l.acquired = acquired
+	l.mu.Unlock()
 }
 
 func (l *lock) tryLock() error {
-	return l.mutex.TryLock(l.cntx)
+	err := l.mutex.TryLock(l.cntx)
+	l.setAcquired(err == nil)
+	return err
 }
 
 func (l *lock) lock() error {
-	return l.mutex.Lock(l.cntx)
+	err := l.mutex.Lock(l.cntx)
+	l.setAcquired(err == nil)
+	return err
 }
 
 func (l *lock) unlock() error {
+	l.setAcquired(false)
 	return l.mutex.Unlock(l.cntx)
 }
 
 func (l *lock) cancel() {
+	l.setAcquired(false)
 	l.myCancel()
 }
 
+func (l *lock) isAcquired() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.acquired
+}
+
+func (l *lock) steal() error {
+	myKey := fmt.Sprintf("%s%x", l.prefix, l.session.Lease())
+	for {
+		// remove the owner and the waiters, they will be queued again for the lock
+		resp, err := l.cli.Get(l.cntx, l.prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+		if err != nil {
+			return err
+		}
+		ops := []clientv3.Op{}
+		for _, kv := range resp.Kvs {
+			if string(kv.Key) != myKey {
+				ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+			}
+		}
+		if len(ops) > 0 {
+			if _, err = l.cli.Txn(l.cntx).Then(ops...).Commit(); err != nil {
+				return err
+			}
+		}
+		err = l.tryLock()
+		if err != concurrency.ErrLocked {
+			return err
+		}
+		// a waiter was queued again before us
+	}
+}
+
+func (l *lock) waitLost() error {
+	myKey := l.mutex.Key()
+	isOwner := l.mutex.IsOwner()
+	myRev := isOwner.TargetUnion.(*etcdserverpb.Compare_CreateRevision).CreateRevision
+	// watch from the creation of our key, so a deletion that already happened is not missed
+	wch := l.cli.Watch(l.cntx, myKey, clientv3.WithRev(myRev))
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wresp.Events {
+			if ev.Type != mvccpb.DELETE {
+				continue
+			}
+			if !l.isAcquired() {
+				return errLockReleased
+			}
+			l.setAcquired(false)
+			return nil
+		}
+	}
+	if err := l.cntx.Err(); err != nil {
+		return err
+	}
+	return errLockReleased
+}
+
+func (l *lock) isOwner() ([]clientv3.Cmp, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.acquired {
+		return nil, false
+	}
+	// our key still exists, and there is no older key (of another session) that owns the lock
+	isOwner := l.mutex.IsOwner()
+	myRev := isOwner.TargetUnion.(*etcdserverpb.Compare_CreateRevision).CreateRevision
+	noOlder := clientv3.Compare(clientv3.CreateRevision(l.prefix), ">", myRev-1).WithPrefix()
+	return []clientv3.Cmp{isOwner, noOlder}, true
+}
+
 var EtcdClientTimeout = time.Second
 
 func NewEtcdClient(endpoints []string) (*clientv3.Client, error) {
@@ -83,16 +190,10 @@ func NewEtcdClient(endpoints []string) (*clientv3.Client, error) {
 }
 
 func NewDatabaseEtcd(cli *clientv3.Client) (Databaser, error) {
+	schemas := libovsdb.Schemas{}
 	return &DatabaseEtcd{cli: cli,
-		Schemas: libovsdb.Schemas{}, strSchemas: map[string]map[string]interface{}{}, locks: map[string]*sync.Mutex{}}, nil
-}
-
-func (con *DatabaseEtcd) DbLock(dbName string) {
-	con.locks[dbName].Lock()
-}
-
-func (con *DatabaseEtcd) DbUnlock(dbName string) {
-	con.locks[dbName].Unlock()
+		Schemas: schemas, strSchemas: map[string]map[string]interface{}{},
+		ephemeral: NewEphemeralOwner(cli, schemas, klogr.New().WithName("ephemeral"))}, nil
 }
 
 func (con *DatabaseEtcd) GetLock(ctx context.Context, id string) (Locker, error) {
@@ -104,7 +205,8 @@ func (con *DatabaseEtcd) GetLock(ctx context.Context, id string) (Locker, error)
 	}
 	key := common.NewLockKey(id)
 	mutex := concurrency.NewMutex(session, key.String())
-	return &lock{mutex: mutex, myCancel: cancel, cntx: ctctx}, nil
+	// the mutex keys are under the "<key>/" prefix
+	return &lock{mutex: mutex, session: session, cli: con.cli, prefix: key.String() + "/", myCancel: cancel, cntx: ctctx}, nil
 }
 
 func (con *DatabaseEtcd) AddSchema(schemaFile string) error {
@@ -124,12 +226,12 @@ func (con *DatabaseEtcd) AddSchema(schemaFile string) error {
 	schemaName := schemaMap["name"].(string)
 	con.mu.Lock()
 	con.strSchemas[schemaName] = schemaMap
-	con.locks[schemaName] = &sync.Mutex{}
 	con.mu.Unlock()
 	schemaSet, err := libovsdb.NewOvsSet(string(data))
-	srv := _Server.Database{Model: "standalone", Name: schemaName, Uuid: libovsdb.UUID{GoUUID: uuid.NewString()},
-		Connected: true, Leader: true, Schema: *schemaSet, Version: libovsdb.UUID{GoUUID: uuid.NewString()}}
-	key := common.NewDataKey("_Server", "Database", schemaName)
+	// the uuid is derived from the database name, so there is a single row per database
+	key := common.NewDataKey("_Server", "Database", uuid.NewSHA1(uuid.NameSpaceOID, []byte(schemaName)).String())
+	srv := _Server.Database{Model: "standalone", Name: schemaName, Uuid: libovsdb.UUID{GoUUID: key.UUID},
+		Connected: true, Leader: true, Schema: *schemaSet}
 	ctx, cancel := context.WithTimeout(context.Background(), EtcdClientTimeout)
 	defer cancel()
 	if err := (*con).PutData(ctx, key, srv); err != nil {
@@ -180,33 +282,139 @@ func (con *DatabaseEtcd) GetData(keys []common.Key) (*clientv3.TxnResponse, erro
 	return res, err
 }
 
+// GetDataAtRevision returns the data of the keys as it was at the revision
+func (con *DatabaseEtcd) GetDataAtRevision(keys []common.Key, revision int64) (*clientv3.TxnResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), EtcdClientTimeout)
+	ops := []clientv3.Op{}
+	for _, key := range keys {
+		ops = append(ops, clientv3.OpGet(key.String(), clientv3.WithPrefix(), clientv3.WithRev(revision)))
+	}
+	res, err := con.cli.Txn(ctx).Then(ops...).Commit()
+	cancel()
+	if err != nil {
+		klog.Errorf("GetDataAtRevision returned error: %v", err)
+	}
+	return res, err
+}
+
 func (con *DatabaseEtcd) GetSchema(name string) map[string]interface{} {
 	return con.strSchemas[name]
 }
 
+func (con *DatabaseEtcd) GetEphemeralOwner() *EphemeralOwner {
+	return con.ephemeral
+}
+
 func (con *DatabaseEtcd) PutData(ctx context.Context, key common.Key, obj interface{}) error {
 	data, err := json.Marshal(obj)
 	if err != nil {
 		return err
 	}
-	_, err = con.cli.Put(ctx, key.String(), string(data))
+	row := map[string]interface{}{}
+	if err = json.Unmarshal(data, &row); err != nil {
+		return err
+	}
+	value, err := makeValue(&row)
+	if err != nil {
+		return err
+	}
+	_, err = con.cli.Put(ctx, key.String(), value)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// MigrateData rewrites the rows that were stored by older versions of the server: the _uuid and _version columns are
+// removed from the row values, and the rows of _Server/Database that are keyed by the database name are deleted (they
+// are stored again by AddSchema). It returns the number of the migrated rows.
+func (con *DatabaseEtcd) MigrateData(ctx context.Context) (int, error) {
+	migrated := 0
+	for dbName, databaseSchema := range con.Schemas {
+		for table := range databaseSchema.Tables {
+			tableKey := common.NewTableKey(dbName, table)
+			res, err := con.cli.Get(ctx, tableKey.TableKeyString(), clientv3.WithPrefix())
+			if err != nil {
+				return migrated, err
+			}
+			for _, kv := range res.Kvs {
+				op, err := migrateRow(kv)
+				if err != nil {
+					return migrated, err
+				}
+				if op == nil {
+					continue
+				}
+				tres, err := con.cli.Txn(ctx).If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+					Then(*op).Commit()
+				if err != nil {
+					return migrated, err
+				}
+				if !tres.Succeeded {
+					klog.Warningf("MigrateData: row %s was modified during the migration", string(kv.Key))
+					continue
+				}
+				migrated++
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// migrateRow returns the operation that migrates the row, or nil if the row doesn't have to be migrated
+func migrateRow(kv *mvccpb.KeyValue) (*clientv3.Op, error) {
+	key, err := common.ParseKey(string(kv.Key))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = uuid.Parse(key.UUID); err != nil {
+		op := clientv3.OpDelete(string(kv.Key))
+		return &op, nil
+	}
+	row := map[string]interface{}{}
+	if err = json.Unmarshal(kv.Value, &row); err != nil {
+		return nil, err
+	}
+	_, hasUUID := row[COL_UUID]
+	_, hasVersion := row[COL_VERSION]
+	if !hasUUID && !hasVersion {
+		return nil, nil
+	}
+	value, err := makeValue(&row)
+	if err != nil {
+		return nil, err
+	}
+	op := clientv3.OpPut(string(kv.Key), value)
+	return &op, nil
+}
+
+// CreateMonitor returns a monitor of the database that is subscribed to the shared watch of the database, the watch is
+// started by its first monitor and stopped after its last monitor is canceled
 func (con *DatabaseEtcd) CreateMonitor(dbName string, handler *Handler, log logr.Logger) *dbMonitor {
 	m := newMonitor(dbName, handler, log)
-	ctxt, cancel := context.WithCancel(context.Background())
-	m.cancel = cancel
-	key := common.NewDBPrefixKey(dbName)
-	wch := con.cli.Watch(clientv3.WithRequireLeader(ctxt), key.String(),
-		clientv3.WithPrefix(),
-		clientv3.WithCreatedNotify(),
-		clientv3.WithPrevKV())
-	m.watchChannel = wch
-	return m
+	for {
+		con.mu.Lock()
+		if con.watchers == nil {
+			con.watchers = map[string]*dbWatcher{}
+		}
+		w, ok := con.watchers[dbName]
+		if !ok {
+			w = newDbWatcher(con.cli, dbName, klogr.New(), con.removeWatcher)
+			con.watchers[dbName] = w
+		}
+		con.mu.Unlock()
+		if w.subscribe(m) {
+			return m
+		}
+	}
+}
+
+func (con *DatabaseEtcd) removeWatcher(w *dbWatcher) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	if con.watchers[w.dbName] == w {
+		delete(con.watchers, w.dbName)
+	}
 }
 
 type DatabaseMock struct {
@@ -239,6 +447,18 @@ func (l *LockerMock) cancel() {
 	l.Mu.Unlock()
 }
 
+func (l *LockerMock) isOwner() ([]clientv3.Cmp, bool) {
+	return []clientv3.Cmp{}, l.Error == nil
+}
+
+func (l *LockerMock) steal() error {
+	return l.Error
+}
+
+func (l *LockerMock) waitLost() error {
+	return errLockReleased
+}
+
 func NewDatabaseMock() (Databaser, error) {
 	return &DatabaseMock{}, nil
 }
@@ -264,6 +484,10 @@ func (con *DatabaseMock) GetData(keys []common.Key) (*clientv3.TxnResponse, erro
 	return con.Response.(*clientv3.TxnResponse), con.Error
 }
 
+func (con *DatabaseMock) GetDataAtRevision(keys []common.Key, revision int64) (*clientv3.TxnResponse, error) {
+	return con.Response.(*clientv3.TxnResponse), con.Error
+}
+
 func (con *DatabaseMock) PutData(ctx context.Context, key common.Key, obj interface{}) error {
 	return con.Error
 }
@@ -272,6 +496,10 @@ func (con *DatabaseMock) GetSchema(name string) map[string]interface{} {
 	return nil
 }
 
+func (con *DatabaseMock) GetEphemeralOwner() *EphemeralOwner {
+	return nil
+}
+
 func (con *DatabaseMock) GetUUID() string {
 	return con.Response.(string)
 }
@@ -282,6 +510,3 @@ func (con *DatabaseMock) CreateMonitor(dbName string, handler *Handler, log logr
 	m.cancel = cancel
 	return m
 }
-
-func (con *DatabaseMock) DbLock(dbName string)   {}
-func (con *DatabaseMock) DbUnlock(dbName string) {}
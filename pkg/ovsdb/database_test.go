@@ -3,7 +3,9 @@ package ovsdb
 import (
 	"context"
 	"testing"
+	"time"
 
+	guuid "github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	clientv3 "go.etcd.io/etcd/client/v3"
 
@@ -43,3 +45,88 @@ func TestMockGetData(t *testing.T) {
 	assert.Equal(t, expectedError, actualError)
 	assert.Equal(t, expectedResponse, actualResponse)
 }
+
+func TestLockSteal(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	ctx := context.Background()
+	lock1, err := db.GetLock(ctx, "lock1")
+	assert.Nil(t, err)
+	defer lock1.cancel()
+	lock2, err := db.GetLock(ctx, "lock1")
+	assert.Nil(t, err)
+	defer lock2.cancel()
+
+	assert.Nil(t, lock1.tryLock())
+	lost := make(chan error)
+	go func() {
+		lost <- lock1.waitLost()
+	}()
+
+	assert.Nil(t, lock2.steal())
+	_, ok := lock2.isOwner()
+	assert.True(t, ok)
+	select {
+	case err = <-lost:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't lost")
+	}
+	_, ok = lock1.isOwner()
+	assert.False(t, ok)
+
+	/* the previous owner waits until the thief releases the lock */
+	locked := make(chan error)
+	go func() {
+		locked <- lock1.lock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the lock was acquired while it is owned by another client")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.Nil(t, lock2.unlock())
+	select {
+	case err = <-locked:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't acquired")
+	}
+	_, ok = lock1.isOwner()
+	assert.True(t, ok)
+}
+
+func TestMigrateData(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	con := db.(*DatabaseEtcd)
+	con.Schemas.Add(testSchemaSimple)
+
+	/* a row stored by an older version */
+	key := common.GenerateDataKey("simple", "table1")
+	val := `{"_uuid":["uuid","` + key.UUID + `"],"_version":["uuid","` + guuid.NewString() + `"],"key1":"val1"}`
+	_, err = cli.Put(context.TODO(), key.String(), val)
+	assert.Nil(t, err)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{"key1": "val2"})
+
+	migrated, err := con.MigrateData(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, migrated)
+	res, err := cli.Get(context.TODO(), key.String())
+	assert.Nil(t, err)
+	assert.Equal(t, `{"key1":"val1"}`, string(res.Kvs[0].Value))
+
+	migrated, err = con.MigrateData(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, migrated)
+}
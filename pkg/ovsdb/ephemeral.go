@@ -0,0 +1,319 @@
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// EphemeralLeaseTTL is the time to live (in seconds) of the etcd lease that owns the ephemeral columns written by this
+// server. The ephemeral columns are reset within this time after the server dies.
+var EphemeralLeaseTTL = 60
+
+// EphemeralOwner owns, by an etcd lease, the ephemeral columns written by the transactions of this server.
+//
+// The ephemeral columns are stored in their rows like any other column, but a transaction that modifies the ephemeral
+// columns of a row also puts the ephemeral key of the row, attached to the lease (see etcdMarkEphemerals). When the
+// lease expires, etcd deletes the ephemeral keys, and the owners of the live servers reset the ephemeral columns of
+// their rows to the default values. The reset is a regular modification of the rows, so the reads and the monitors
+// don't handle the ephemeral columns differently.
+type EphemeralOwner struct {
+	log     logr.Logger
+	cli     *clientv3.Client
+	schemas libovsdb.Schemas
+
+	mu      sync.Mutex
+	session *concurrency.Session
+}
+
+func NewEphemeralOwner(cli *clientv3.Client, schemas libovsdb.Schemas, log logr.Logger) *EphemeralOwner {
+	return &EphemeralOwner{log: log, cli: cli, schemas: schemas}
+}
+
+// Lease returns the lease of the ephemeral keys written by this server, a new lease is granted if the previous one
+// expired.
+func (o *EphemeralOwner) Lease() (clientv3.LeaseID, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.session != nil {
+		select {
+		case <-o.session.Done():
+			o.log.Info("ephemeral lease expired", "lease", o.session.Lease())
+			o.session = nil
+		default:
+			return o.session.Lease(), nil
+		}
+	}
+	session, err := concurrency.NewSession(o.cli, concurrency.WithTTL(EphemeralLeaseTTL))
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	o.session = session
+	return session.Lease(), nil
+}
+
+// Run resets the ephemeral columns that are not owned by a live server, until the context is canceled. The rows that
+// are not owned when it starts (e.g. all the servers were down) are reset first, then it watches the expiration of
+// the ephemeral keys.
+func (o *EphemeralOwner) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		revision, err := o.sweep(ctx)
+		if err != nil {
+			o.log.Error(err, "ephemeral sweep failed")
+			time.Sleep(EtcdClientTimeout)
+			continue
+		}
+		o.watch(ctx, revision)
+	}
+}
+
+// sweep resets the ephemeral columns of the rows without an ephemeral key, it returns the revision of the sweep
+func (o *EphemeralOwner) sweep(ctx context.Context) (int64, error) {
+	ops := []clientv3.Op{}
+	tables := []*libovsdb.TableSchema{}
+	dbNames := []string{}
+	for dbName := range o.schemas {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		for table, tableSchema := range o.schemas[dbName].Tables {
+			if len(tableSchema.EphemeralColumns()) == 0 {
+				continue
+			}
+			tableSchema := tableSchema
+			tableKey := common.NewTableKey(dbName, table)
+			ephemeralKey := common.NewEphemeralKey(dbName, table, "")
+			ops = append(ops, clientv3.OpGet(tableKey.TableKeyString(), clientv3.WithPrefix()),
+				clientv3.OpGet(ephemeralKey.String(), clientv3.WithPrefix(), clientv3.WithKeysOnly()))
+			tables = append(tables, &tableSchema)
+		}
+	}
+	res, err := o.cli.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return 0, err
+	}
+	for i, tableSchema := range tables {
+		owned := map[string]bool{}
+		for _, kv := range res.Responses[2*i+1].GetResponseRange().Kvs {
+			owned[string(kv.Key)] = true
+		}
+		for _, kv := range res.Responses[2*i].GetResponseRange().Kvs {
+			key, err := common.ParseKey(string(kv.Key))
+			if err != nil {
+				o.log.Error(err, "parseKey failed")
+				continue
+			}
+			ephemeralKey := common.NewEphemeralKey(key.DBName, key.TableName, key.UUID)
+			if owned[ephemeralKey.String()] {
+				continue
+			}
+			if err = o.reset(ctx, tableSchema, key); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return res.Header.Revision, nil
+}
+
+// watch resets the ephemeral columns of the rows whose ephemeral keys are deleted after the given revision
+func (o *EphemeralOwner) watch(ctx context.Context, revision int64) {
+	ephemeralTableKey := common.NewEphemeralTableKey()
+	wch := o.cli.Watch(clientv3.WithRequireLeader(ctx), ephemeralTableKey.TableKeyString(), clientv3.WithPrefix(),
+		clientv3.WithRev(revision+1))
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			o.log.Error(err, "ephemeral watch failed")
+			return
+		}
+		for _, ev := range wresp.Events {
+			if ev.Type != mvccpb.DELETE {
+				continue
+			}
+			key, err := common.ParseKey(string(ev.Kv.Key))
+			if err != nil {
+				o.log.Error(err, "parseKey failed")
+				continue
+			}
+			rowKey, tableSchema, err := o.ephemeralRowKey(key.UUID)
+			if err != nil {
+				o.log.Error(err, "unknown ephemeral key", "key", key.String())
+				continue
+			}
+			if err = o.reset(ctx, tableSchema, rowKey); err != nil {
+				o.log.Error(err, "ephemeral reset failed", "key", rowKey.ShortString())
+				return
+			}
+		}
+	}
+}
+
+// ephemeralRowKey returns the key of the row of an ephemeral key, by its "<dbname>.<table>.<uuid>" id
+func (o *EphemeralOwner) ephemeralRowKey(id string) (*common.Key, *libovsdb.TableSchema, error) {
+	i := strings.LastIndex(id, ".")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("wrong formatted ephemeral id %q", id)
+	}
+	j := strings.LastIndex(id[:i], ".")
+	if j < 0 {
+		return nil, nil, fmt.Errorf("wrong formatted ephemeral id %q", id)
+	}
+	key := common.NewDataKey(id[:j], id[j+1:i], id[i+1:])
+	tableSchema, err := o.schemas.LookupTable(key.DBName, key.TableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &key, tableSchema, nil
+}
+
+// reset resets the ephemeral columns of the row to their default values, unless the row is deleted or a server owns
+// its ephemeral columns again.
+func (o *EphemeralOwner) reset(ctx context.Context, tableSchema *libovsdb.TableSchema, key *common.Key) error {
+	ephemeralKey := common.NewEphemeralKey(key.DBName, key.TableName, key.UUID)
+	for {
+		res, err := o.cli.Get(ctx, key.String())
+		if err != nil {
+			return err
+		}
+		if len(res.Kvs) == 0 {
+			return nil
+		}
+		kv := res.Kvs[0]
+		val, modified, err := ephemeralReset(tableSchema, kv.Value)
+		if err != nil {
+			return err
+		}
+		if !modified {
+			return nil
+		}
+		tres, err := o.cli.Txn(ctx).If(
+			clientv3.Compare(clientv3.ModRevision(key.String()), "=", kv.ModRevision),
+			clientv3.Compare(clientv3.CreateRevision(ephemeralKey.String()), "=", 0),
+		).Then(clientv3.OpPut(key.String(), val)).Else(clientv3.OpGet(ephemeralKey.String(), clientv3.WithCountOnly())).Commit()
+		if err != nil {
+			return err
+		}
+		if tres.Succeeded {
+			o.log.V(5).Info("reset ephemeral columns", "key", key.ShortString())
+			return nil
+		}
+		if tres.Responses[0].GetResponseRange().Count > 0 {
+			return nil
+		}
+		/* the row was modified, reset the new value */
+	}
+}
+
+// ephemeralRow returns the stored row with the types of the schema, a nil value stands for a row with default values
+func ephemeralRow(tableSchema *libovsdb.TableSchema, val []byte) (map[string]interface{}, error) {
+	row := map[string]interface{}{}
+	if val != nil {
+		if err := json.Unmarshal(val, &row); err != nil {
+			return nil, err
+		}
+	}
+	tableSchema.Default(&row)
+	if err := tableSchema.Unmarshal(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// ephemeralModified returns true if the values of the ephemeral columns differ between the stored rows
+func ephemeralModified(tableSchema *libovsdb.TableSchema, prevVal, val []byte) (bool, error) {
+	prevRow, err := ephemeralRow(tableSchema, prevVal)
+	if err != nil {
+		return false, err
+	}
+	row, err := ephemeralRow(tableSchema, val)
+	if err != nil {
+		return false, err
+	}
+	for _, column := range tableSchema.EphemeralColumns() {
+		if !isEqualColumn(tableSchema.Columns[column], prevRow[column], row[column]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ephemeralReset returns the stored row with the ephemeral columns reset to their default values, and false if they
+// already have the default values.
+func ephemeralReset(tableSchema *libovsdb.TableSchema, val []byte) (string, bool, error) {
+	modified, err := ephemeralModified(tableSchema, nil, val)
+	if err != nil || !modified {
+		return "", false, err
+	}
+	row := map[string]interface{}{}
+	if err = json.Unmarshal(val, &row); err != nil {
+		return "", false, err
+	}
+	for _, column := range tableSchema.EphemeralColumns() {
+		row[column] = tableSchema.Columns[column].Default()
+	}
+	newVal, err := makeValue(&row)
+	return newVal, true, err
+}
+
+// etcdMarkEphemerals puts the ephemeral keys of the rows whose ephemeral columns are modified by the transaction,
+// attached to the lease of the server, and deletes the ephemeral keys of the deleted rows.
+func (txn *Transaction) etcdMarkEphemerals() error {
+	lease := clientv3.NoLease
+	for _, ev := range txn.etcd.Events {
+		key, err := common.ParseKey(etcdEventKey(ev))
+		if err != nil {
+			txn.log.Error(err, "parseKey failed")
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		tableSchema, err := txn.schemas.LookupTable(key.DBName, key.TableName)
+		if err != nil {
+			txn.log.Error(err, "missing table schema", "table", key.TableName)
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		if len(tableSchema.EphemeralColumns()) == 0 {
+			continue
+		}
+		ephemeralKey := common.NewEphemeralKey(key.DBName, key.TableName, key.UUID)
+		if ev.Type == mvccpb.DELETE {
+			txn.etcd.Then = append(txn.etcd.Then, clientv3.OpDelete(ephemeralKey.String()))
+			txn.etcd.EventsNilCount++
+			continue
+		}
+		var prevVal []byte
+		if !etcdEventIsCreate(ev) {
+			prevVal = ev.PrevKv.Value
+		}
+		modified, err := ephemeralModified(tableSchema, prevVal, ev.Kv.Value)
+		if err != nil {
+			txn.log.Error(err, "failed to compare ephemeral columns", "key", key.ShortString())
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		if !modified || txn.ephemeral == nil {
+			/* without an owner, the ephemeral key isn't written, an ephemeral key without a lease is never deleted */
+			continue
+		}
+		if lease == clientv3.NoLease {
+			if lease, err = txn.ephemeral.Lease(); err != nil {
+				txn.log.Error(err, "failed to grant ephemeral lease")
+				return errors.New(E_IO_ERROR)
+			}
+		}
+		txn.etcd.Then = append(txn.etcd.Then, clientv3.OpPut(ephemeralKey.String(), "", clientv3.WithLease(lease)))
+		txn.etcd.EventsNilCount++
+	}
+	txn.etcd.Assert()
+	return nil
+}
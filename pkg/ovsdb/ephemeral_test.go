@@ -0,0 +1,158 @@
+package ovsdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/klog/v2/klogr"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+var testEphemeral = true
+
+var testSchemaEphemeral *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
+	Name:    "ephemeral",
+	Version: "0.0.0",
+	Tables: map[string]libovsdb.TableSchema{
+		"table1": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"name": {
+					Type: libovsdb.TypeString,
+				},
+				"status": {
+					Type:      libovsdb.TypeString,
+					Ephemeral: &testEphemeral,
+				},
+			},
+		},
+	},
+}
+
+func testEphemeralOwner(t *testing.T) (*EphemeralOwner, *clientv3.Client) {
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	schemas := libovsdb.Schemas{}
+	schemas.Add(testSchemaEphemeral)
+	return NewEphemeralOwner(cli, schemas, klogr.New()), cli
+}
+
+func testEphemeralTransact(t *testing.T, owner *EphemeralOwner, operations ...libovsdb.Operation) {
+	req := &libovsdb.Transact{
+		DBName:     "ephemeral",
+		Operations: operations,
+	}
+	txn := testNewTransaction(owner.cli, req)
+	txn.AddSchema(testSchemaEphemeral)
+	txn.ephemeral = owner
+	_, err := txn.Commit()
+	assert.Nil(t, err)
+}
+
+func testEphemeralKeys(t *testing.T, cli *clientv3.Client) *clientv3.GetResponse {
+	key := common.NewEphemeralKey("ephemeral", "table1", "")
+	res, err := cli.Get(context.TODO(), key.String(), clientv3.WithPrefix())
+	assert.Nil(t, err)
+	return res
+}
+
+func testEphemeralWaitStatus(t *testing.T, status string) map[string]interface{} {
+	var dump map[string]interface{}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		dump = testEtcdDump(t, "ephemeral", "table1")
+		if dump["status"] == status {
+			break
+		}
+	}
+	return dump
+}
+
+func TestEphemeralLease(t *testing.T) {
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	owner, cli := testEphemeralOwner(t)
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go owner.Run(ctx)
+
+	row := map[string]interface{}{"name": "name1", "status": "up"}
+	testEphemeralTransact(t, owner, libovsdb.Operation{Op: OP_INSERT, Table: &table, Row: &row})
+	lease, err := owner.Lease()
+	assert.Nil(t, err)
+	res := testEphemeralKeys(t, cli)
+	assert.Equal(t, 1, len(res.Kvs))
+	assert.Equal(t, int64(lease), res.Kvs[0].Lease)
+
+	/* the server is down */
+	_, err = cli.Revoke(context.TODO(), lease)
+	assert.Nil(t, err)
+	dump := testEphemeralWaitStatus(t, "")
+	assert.Equal(t, "", dump["status"])
+	assert.Equal(t, "name1", dump["name"])
+}
+
+func TestEphemeralNoOwner(t *testing.T) {
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	/* the ephemeral key isn't written without a lease */
+	row := map[string]interface{}{"name": "name1", "status": "up"}
+	txn := testNewTransaction(cli, &libovsdb.Transact{
+		DBName:     "ephemeral",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	})
+	txn.AddSchema(testSchemaEphemeral)
+	_, err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, "up", testEtcdDump(t, "ephemeral", "table1")["status"])
+	assert.Equal(t, 0, len(testEphemeralKeys(t, cli).Kvs))
+}
+
+func TestEphemeralSweep(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "ephemeral", "table1", map[string]interface{}{"name": "name1", "status": "up"})
+	owner, cli := testEphemeralOwner(t)
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go owner.Run(ctx)
+
+	dump := testEphemeralWaitStatus(t, "")
+	assert.Equal(t, "", dump["status"])
+	assert.Equal(t, "name1", dump["name"])
+}
+
+func TestEphemeralModify(t *testing.T) {
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	owner, cli := testEphemeralOwner(t)
+	defer cli.Close()
+
+	row := map[string]interface{}{"name": "name1"}
+	testEphemeralTransact(t, owner, libovsdb.Operation{Op: OP_INSERT, Table: &table, Row: &row})
+	assert.Equal(t, 0, len(testEphemeralKeys(t, cli).Kvs))
+
+	update := map[string]interface{}{"name": "name2"}
+	testEphemeralTransact(t, owner, libovsdb.Operation{Op: OP_UPDATE, Table: &table, Where: &[]interface{}{}, Row: &update})
+	assert.Equal(t, 0, len(testEphemeralKeys(t, cli).Kvs))
+
+	update = map[string]interface{}{"status": "up"}
+	testEphemeralTransact(t, owner, libovsdb.Operation{Op: OP_UPDATE, Table: &table, Where: &[]interface{}{}, Row: &update})
+	assert.Equal(t, 1, len(testEphemeralKeys(t, cli).Kvs))
+
+	testEphemeralTransact(t, owner, libovsdb.Operation{Op: OP_DELETE, Table: &table, Where: &[]interface{}{}})
+	assert.Equal(t, 0, len(testEphemeralKeys(t, cli).Kvs))
+	assert.Equal(t, int64(0), testEtcdCount(t, "ephemeral", "table1"))
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
-	"reflect"
 	"sync"
 
 	"github.com/creachadair/jrpc2"
@@ -14,6 +13,7 @@ import (
 	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
 	"github.com/ibm/ovsdb-etcd/pkg/ovsjson"
 	shortuuid "github.com/lithammer/shortuuid/v3"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 	"k8s.io/klog/v2"
@@ -43,16 +43,56 @@ type Handler struct {
 	handlerMonitorData map[string]handlerMonitorData
 
 	databaseLocks map[string]Locker
+
+	// request id to the cancel function of the in-flight transaction
+	transactions map[string]context.CancelFunc
 }
 
 func (ch *Handler) Transact(ctx context.Context, params []interface{}) (interface{}, error) {
+	return ch.transact(ctx, params, false)
+}
+
+// DryRunResponse is the result of a transact_dry_run request
+type DryRunResponse struct {
+	// the results of the operations, as they would be returned by a transact request
+	Results []libovsdb.OperationResult `json:"results"`
+	// the rows that would be written, with their complete old and new values
+	Changes ovsjson.TableUpdates `json:"changes"`
+}
+
+func (ch *Handler) TransactDryRun(ctx context.Context, params []interface{}) (interface{}, error) {
+	return ch.transact(ctx, params, true)
+}
+
+func dryRunChanges(changes TableChanges) ovsjson.TableUpdates {
+	tableUpdates := ovsjson.TableUpdates{}
+	for table, rowChanges := range changes {
+		tableUpdate := ovsjson.TableUpdate{}
+		for _, change := range rowChanges {
+			rowUpdate := ovsjson.RowUpdate{}
+			if change.Old != nil {
+				oldRow := change.Old
+				rowUpdate.Old = &oldRow
+			}
+			if change.New != nil {
+				newRow := change.New
+				rowUpdate.New = &newRow
+			}
+			tableUpdate[change.UUID] = rowUpdate
+		}
+		tableUpdates[table] = tableUpdate
+	}
+	return tableUpdates
+}
+
+func (ch *Handler) transact(ctx context.Context, params []interface{}, dryRun bool) (interface{}, error) {
 	req := jrpc2.InboundRequest(ctx)
 	id := ""
 	if !req.IsNotification() {
 		id = req.ID()
 	}
 	log := ch.log.WithValues("id", id)
-	log.V(5).Info("transact", "params", params)
+	log.V(5).Info("transact", "params", params, "dry-run", dryRun)
 	if ch.closed {
 		log.V(5).Info("transact request, the handler is closed")
 		// prevents old transactions
@@ -62,15 +102,43 @@ func (ch *Handler) Transact(ctx context.Context, params []interface{}) (interfac
 	if err != nil {
 		return nil, err
 	}
-	txn := NewTransaction(ch.etcdClient, log, ovsReq)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if id != "" {
+		ch.mu.Lock()
+		ch.transactions[id] = cancel
+		ch.mu.Unlock()
+		defer func() {
+			ch.mu.Lock()
+			delete(ch.transactions, id)
+			ch.mu.Unlock()
+		}()
+	}
+	txn := NewTransaction(ctx, ch.etcdClient, log, ovsReq)
 	txn.schemas = ch.db.GetSchemas()
-	// temporary solution to provide consistency
-	ch.db.DbLock(ovsReq.DBName)
+	txn.ephemeral = ch.db.GetEphemeralOwner()
+	txn.dryRun = dryRun
+	ch.mu.Lock()
+	for id, myLock := range ch.databaseLocks {
+		txn.locks[id] = myLock
+	}
+	ch.mu.Unlock()
 	rev, err := txn.Commit()
-	ch.db.DbUnlock(ovsReq.DBName)
 
 	if err != nil {
-		return nil, err
+		if err.Error() == E_CANCELED {
+			return nil, err
+		}
+		// the transaction errors are reported by the results, according to RFC 7047 section 4.1.3
+		log.V(5).Info("transact failed", "err", err.Error(), "response", txn.response)
+		if dryRun {
+			return DryRunResponse{Results: txn.Results(err), Changes: ovsjson.TableUpdates{}}, nil
+		}
+		return txn.Results(err), nil
+	}
+	if dryRun {
+		log.V(5).Info("transact dry run response", "response", txn.response)
+		return DryRunResponse{Results: txn.response.Result, Changes: dryRunChanges(txn.changes)}, nil
 	}
 	monitor, ok := ch.monitors[txn.request.DBName]
 	if ok {
@@ -78,6 +146,7 @@ func (ch *Handler) Transact(ctx context.Context, params []interface{}) (interfac
 		// we have to guarantee that a new monitor call if it runs concurrently with the transaction, returns first
 		var wg sync.WaitGroup
 		wg.Add(1)
+		etcdEventsSetRevision(txn.etcd.Events, rev)
 		monitor.notify(txn.etcd.Events, rev, &wg)
 		wg.Wait()
 	}
@@ -86,10 +155,97 @@ func (ch *Handler) Transact(ctx context.Context, params []interface{}) (interfac
 	return txn.response.Result, nil
 }
 
+func (ch *Handler) Revert(ctx context.Context, params []interface{}) (interface{}, error) {
+	ch.log.V(5).Info("revert request", "params", params)
+	if len(params) < 2 {
+		return nil, fmt.Errorf("wrong number of parameters %d, expected [<db-name>, <revision>, <table>*]", len(params))
+	}
+	dbName, ok := params[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("wrong database name type %T, expected string", params[0])
+	}
+	revision, ok := params[1].(float64)
+	if !ok {
+		return nil, fmt.Errorf("wrong revision type %T, expected integer", params[1])
+	}
+	tables := []string{}
+	for _, param := range params[2:] {
+		table, ok := param.(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong table type %T, expected string", param)
+		}
+		tables = append(tables, table)
+	}
+	dbSchema, ok := ch.db.GetSchemas()[dbName]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %q", dbName)
+	}
+	operations, err := RevertOperations(ctx, ch.etcdClient, dbSchema, int64(revision), tables...)
+	if err != nil {
+		ch.log.Error(err, "revert failed", "params", params)
+		return nil, err
+	}
+	comment := fmt.Sprintf("revert to revision %d", int64(revision))
+	txnParams := []interface{}{dbName}
+	for _, op := range operations {
+		txnParams = append(txnParams, op)
+	}
+	txnParams = append(txnParams, libovsdb.Operation{Op: OP_COMMENT, Comment: &comment})
+	return ch.transact(ctx, txnParams, false)
+}
+
+func (ch *Handler) RowHistory(ctx context.Context, params []interface{}) (interface{}, error) {
+	ch.log.V(5).Info("row history request", "params", params)
+	if len(params) != 3 {
+		return nil, fmt.Errorf("wrong number of parameters %d, expected [<db-name>, <table>, <uuid>]", len(params))
+	}
+	args := make([]string, len(params))
+	for i, param := range params {
+		arg, ok := param.(string)
+		if !ok {
+			return nil, fmt.Errorf("wrong parameter type %T, expected string", param)
+		}
+		args[i] = arg
+	}
+	schemas := ch.db.GetSchemas()
+	tableSchema, err := schemas.LookupTable(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	history, err := GetRowHistory(ctx, ch.etcdClient, tableSchema, common.NewDataKey(args[0], args[1], args[2]))
+	if err != nil {
+		ch.log.Error(err, "row history failed", "params", params)
+		return nil, err
+	}
+	return history, nil
+}
+
+// Cancel aborts the in-flight transaction with the given request id, the transaction is replied with the "canceled"
+// error and nothing is committed. As the server dispatches requests by a limited number of tasks, the cancel request
+// can reach an in-flight transaction only if the server runs with more than one concurrent task.
 func (ch *Handler) Cancel(ctx context.Context, param interface{}) (interface{}, error) {
 	ch.log.V(5).Info("cancel request", "param", param)
-
-	return "{Cancel}", nil
+	params, ok := param.([]interface{})
+	if !ok || len(params) != 1 {
+		err := fmt.Errorf("wrong params for cancel %v", param)
+		ch.log.Error(err, "cancel request")
+		return nil, err
+	}
+	// the request ids are kept in their json form
+	buf, err := json.Marshal(params[0])
+	if err != nil {
+		ch.log.Error(err, "cancel request")
+		return nil, err
+	}
+	ch.mu.Lock()
+	cancel, ok := ch.transactions[string(buf)]
+	ch.mu.Unlock()
+	if !ok {
+		ch.log.V(4).Info("cancel: can't find transaction", "id", string(buf))
+		return nil, nil
+	}
+	cancel()
+	return nil, nil
 }
 
 func (ch *Handler) Monitor(ctx context.Context, params []interface{}) (interface{}, error) {
@@ -122,53 +278,110 @@ func (ch *Handler) MonitorCancel(ctx context.Context, param interface{}) (interf
 
 func (ch *Handler) Lock(ctx context.Context, param interface{}) (interface{}, error) {
 	ch.log.V(5).Info("lock request", "param", param)
-	id, err := common.ParamsToString(param)
+	id, myLock, err := ch.newLock(param, "lock")
 	if err != nil {
 		return map[string]bool{"locked": false}, err
 	}
-	ch.mu.Lock()
-	myLock, ok := ch.databaseLocks[id]
-	ch.mu.Unlock()
-	if !ok {
-		myLock, err = ch.db.GetLock(ch.handlerContext, id)
-		if err != nil {
-			ch.log.Error(err, "lock failed", "lockid", id)
-			return nil, err
-		}
-		ch.mu.Lock()
-		// validate that no other locks
-		otherLock, ok := ch.databaseLocks[id]
-		if !ok {
-			ch.databaseLocks[id] = myLock
-		} else {
-			// What should we do ?
-			myLock.cancel()
-			myLock = otherLock
-		}
-		ch.mu.Unlock()
-	}
 	err = myLock.tryLock()
 	if err == nil {
+		go ch.lockNotifier(id, myLock, true)
 		return map[string]bool{"locked": true}, nil
 	} else if err != concurrency.ErrLocked {
 		ch.log.Error(err, "lock failed", "lockid", id)
-		// TOD is it correct?
+		ch.removeLock(id)
 		return nil, err
 	}
-	go func() {
-		err = myLock.lock()
-		if err == nil {
-			// Send notification
-			ch.log.V(5).Info("lock succeeded", "lockid", id)
+	go ch.lockNotifier(id, myLock, false)
+	return map[string]bool{"locked": false}, nil
+}
+
+// newLock creates a lock for the given lock request, the client has to unlock a lock before it requests it again
+func (ch *Handler) newLock(param interface{}, method string) (string, Locker, error) {
+	id, err := common.ParamsToString(param)
+	if err != nil {
+		return "", nil, err
+	}
+	ch.mu.Lock()
+	_, ok := ch.databaseLocks[id]
+	ch.mu.Unlock()
+	if ok {
+		err = fmt.Errorf("must issue \"unlock\" before new \"%s\"", method)
+		ch.log.Error(err, "duplicate lock request", "lockid", id)
+		return "", nil, err
+	}
+	myLock, err := ch.db.GetLock(ch.handlerContext, id)
+	if err != nil {
+		ch.log.Error(err, "lock failed", "lockid", id)
+		return "", nil, err
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if _, ok := ch.databaseLocks[id]; ok {
+		myLock.cancel()
+		err = fmt.Errorf("must issue \"unlock\" before new \"%s\"", method)
+		ch.log.Error(err, "duplicate lock request", "lockid", id)
+		return "", nil, err
+	}
+	ch.databaseLocks[id] = myLock
+	return id, myLock, nil
+}
+
+func (ch *Handler) removeLock(id string) {
+	ch.mu.Lock()
+	myLock, ok := ch.databaseLocks[id]
+	delete(ch.databaseLocks, id)
+	ch.mu.Unlock()
+	if ok {
+		myLock.cancel()
+	}
+}
+
+// lockRequested returns true while the client didn't unlock the lock
+func (ch *Handler) lockRequested(id string, myLock Locker) bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return !ch.closed && ch.databaseLocks[id] == myLock
+}
+
+// lockNotifier runs as long as the client holds or waits for the lock. It sends the "locked" notification when the
+// lock is acquired, and the "stolen" notification when another client steals it, after which the client waits for the
+// lock again.
+func (ch *Handler) lockNotifier(id string, myLock Locker, acquired bool) {
+	log := ch.log.WithValues("lockid", id)
+	for {
+		if !acquired {
+			err := myLock.lock()
+			if err == concurrency.ErrSessionExpired && ch.lockRequested(id, myLock) {
+				// our place in the queue was removed by a steal request
+				log.V(5).Info("lock request was dropped, requesting again")
+				continue
+			}
+			if err != nil {
+				if ch.lockRequested(id, myLock) {
+					log.Error(err, "lock failed")
+				}
+				return
+			}
+			log.V(5).Info("lock succeeded")
 			if err := ch.jrpcServer.Notify(ch.handlerContext, "locked", []string{id}); err != nil {
-				klog.Errorf("notification %v\n", err)
+				log.Error(err, "locked notification failed")
 				return
 			}
-		} else {
-			ch.log.Error(err, "lock failed", "lockid", id)
 		}
-	}()
-	return map[string]bool{"locked": false}, nil
+		if err := myLock.waitLost(); err != nil {
+			log.V(5).Info("lock released", "reason", err.Error())
+			return
+		}
+		if !ch.lockRequested(id, myLock) {
+			return
+		}
+		log.V(5).Info("lock stolen")
+		if err := ch.jrpcServer.Notify(ch.handlerContext, "stolen", []string{id}); err != nil {
+			log.Error(err, "stolen notification failed")
+			return
+		}
+		acquired = false
+	}
 }
 
 func (ch *Handler) Unlock(ctx context.Context, param interface{}) (interface{}, error) {
@@ -191,8 +404,17 @@ func (ch *Handler) Unlock(ctx context.Context, param interface{}) (interface{},
 
 func (ch *Handler) Steal(ctx context.Context, param interface{}) (interface{}, error) {
 	ch.log.V(5).Info("steal request", "param", param)
-	// TODO
-	return "{Steal}", nil
+	id, myLock, err := ch.newLock(param, "steal")
+	if err != nil {
+		return map[string]bool{"locked": false}, err
+	}
+	if err = myLock.steal(); err != nil {
+		ch.log.Error(err, "steal failed", "lockid", id)
+		ch.removeLock(id)
+		return nil, err
+	}
+	go ch.lockNotifier(id, myLock, true)
+	return map[string]bool{"locked": true}, nil
 }
 
 func (ch *Handler) MonitorCond(ctx context.Context, params []interface{}) (interface{}, error) {
@@ -239,39 +461,116 @@ func (ch *Handler) MonitorCondChange(ctx context.Context, params []interface{})
 			mcrs[k] = []ovsjson.MonitorCondRequest{v}
 		}
 	}
-	if reflect.DeepEqual(oldJsonValue, newJsonValue) {
-		ch.log.V(5).Info("MonitorCondChange, update existing monitor")
-		jsonValueString := jsonValueToString(oldJsonValue)
-		ch.mu.Lock()
-		defer ch.mu.Unlock()
-		monitorData, ok := ch.handlerMonitorData[jsonValueString]
-		if !ok {
-			err := fmt.Errorf("unknown monitor")
-			ch.log.Error(err, "update unexisting dbMonitor", "jsonValue", oldJsonValue)
+	oldJsonValueString := jsonValueToString(oldJsonValue)
+	newJsonValueString := jsonValueToString(newJsonValue)
+	log := ch.log.WithValues("jsonValue", newJsonValue)
+	// the handler lock is held only to check and swap the json-values, the new json-value is reserved while the
+	// updaters are built and the snapshot of the monitor is read
+	ch.mu.Lock()
+	monitorData, ok := ch.handlerMonitorData[oldJsonValueString]
+	if !ok {
+		ch.mu.Unlock()
+		err := fmt.Errorf("unknown monitor")
+		ch.log.Error(err, "update unexisting dbMonitor", "jsonValue", oldJsonValue)
+		return nil, err
+	}
+	if newJsonValueString != oldJsonValueString {
+		if _, ok := ch.handlerMonitorData[newJsonValueString]; ok {
+			ch.mu.Unlock()
+			err := fmt.Errorf("duplicate monitor ID")
+			ch.log.Error(err, "monitorCondChange request", "jsonValue", newJsonValue)
 			return nil, err
 		}
-		dbName := monitorData.dataBaseName
-		monitor, ok := ch.monitors[dbName]
-		if !ok {
-			ch.log.Info("MonitorCondChange there is no monitor", "dbname", monitorData.dataBaseName)
+	}
+	dbName := monitorData.dataBaseName
+	monitor, ok := ch.monitors[dbName]
+	if !ok {
+		ch.mu.Unlock()
+		err := fmt.Errorf("there is no monitor for %s", dbName)
+		ch.log.Error(err, "monitorCondChange request", "jsonValue", oldJsonValue)
+		return nil, err
+	}
+	newMonitorData := monitorData
+	newMonitorData.log = log
+	newMonitorData.jsonValue = newJsonValue
+	// the monitor notifies the json-values of its updaters while holding its lock, both json-values are kept while
+	// the updaters are changed
+	monitor.mu.Lock()
+	ch.handlerMonitorData[newJsonValueString] = newMonitorData
+	monitor.mu.Unlock()
+	ch.mu.Unlock()
+
+	updatersMap, updatersKeys, err := ch.condChangeUpdaters(monitor, monitorData, oldJsonValueString, newJsonValueString, mcrs, log)
+	if err == nil {
+		err = monitor.changeUpdaters(oldJsonValueString, newJsonValueString, updatersMap)
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	if err != nil {
+		ch.log.Error(err, "MonitorCondChange failed", "jsonValue", oldJsonValue)
+		if newJsonValueString != oldJsonValueString {
+			delete(ch.handlerMonitorData, newJsonValueString)
+		} else if _, ok := ch.handlerMonitorData[oldJsonValueString]; ok {
+			ch.handlerMonitorData[oldJsonValueString] = monitorData
 		}
-		for tableName, mcrArray := range mcrs {
-			key := common.NewTableKey(dbName, tableName)
-			_, ok := monitor.key2Updaters[key]
-			if !ok {
-				ch.log.V(6).Info("MonitorCondChange", "table", tableName, "mcr", mcrArray)
-				var updaters []updater
-				for _, mcr := range mcrArray {
-					updater := mcrToUpdater(mcr, jsonValueString, monitorData.notificationType == ovsjson.Update)
-					updaters = append(updaters, *updater)
+		return nil, err
+	}
+	if _, ok := ch.handlerMonitorData[newJsonValueString]; !ok {
+		err := fmt.Errorf("unknown monitor")
+		ch.log.Error(err, "monitor was canceled during MonitorCondChange", "jsonValue", newJsonValue)
+		return nil, err
+	}
+	newMonitorData.updatersKeys = updatersKeys
+	ch.handlerMonitorData[newJsonValueString] = newMonitorData
+	if newJsonValueString != oldJsonValueString {
+		delete(ch.handlerMonitorData, oldJsonValueString)
+	}
+	return ovsjson.EmptyStruct{}, nil
+}
+
+// condChangeUpdaters builds the updaters of the monitor-cond-change requests and returns them with the keys of the
+// monitored tables.
+func (ch *Handler) condChangeUpdaters(monitor *dbMonitor, monitorData handlerMonitorData, oldJsonValueString, newJsonValueString string,
+	mcrs map[string][]ovsjson.MonitorCondRequest, log logr.Logger) (Key2Updaters, []common.Key, error) {
+	dbName := monitorData.dataBaseName
+	updatersMap := Key2Updaters{}
+	updatersKeys := append([]common.Key{}, monitorData.updatersKeys...)
+	for tableName, mcrArray := range mcrs {
+		ch.log.V(6).Info("MonitorCondChange", "table", tableName, "mcr", mcrArray)
+		key := common.NewTableKey(dbName, tableName)
+		// the requests of a monitored table replace the conditions of its updaters, the columns and the select of
+		// an updater are kept unless they are given
+		oldUpdaters := monitor.jsonValueUpdaters(key, oldJsonValueString)
+		if len(oldUpdaters) == 0 {
+			updatersKeys = append(updatersKeys, key)
+		} else if len(oldUpdaters) != len(mcrArray) {
+			err := fmt.Errorf("table %s: wrong number of monitor-cond-update-requests %d, expected %d", tableName, len(mcrArray), len(oldUpdaters))
+			ch.log.Error(err, "MonitorCondChange", "table", tableName, "mcr", mcrArray)
+			return nil, nil, err
+		}
+		var updaters []updater
+		tableSchema := ch.monitorTableSchema(dbName, tableName)
+		for i, mcr := range mcrArray {
+			updater, err := mcrToUpdater(mcr, newJsonValueString, monitorData.notificationType == ovsjson.Update, tableSchema, log)
+			if err != nil {
+				ch.log.Error(err, "MonitorCondChange", "table", tableName, "mcr", mcr)
+				return nil, nil, fmt.Errorf("table %s: %s", tableName, err.Error())
+			}
+			if len(oldUpdaters) > 0 {
+				if mcr.Columns == nil {
+					updater.Columns = oldUpdaters[i].Columns
+				}
+				if mcr.Select == nil {
+					updater.Select = oldUpdaters[i].Select
 				}
-				monitorData.updatersKeys = append(monitorData.updatersKeys, key)
-			} else {
-				// TODO update "existing" updaters, change "where"
 			}
+			updaters = append(updaters, *updater)
 		}
+		updatersMap[key] = updaters
 	}
-	return ovsjson.EmptyStruct{}, nil
+	return updatersMap, updatersKeys, nil
 }
 
 func (ch *Handler) MonitorCondSince(ctx context.Context, params []interface{}) (interface{}, error) {
@@ -281,8 +580,32 @@ func (ch *Handler) MonitorCondSince(ctx context.Context, params []interface{}) (
 		ch.log.Error(err, "MonitorCondSince failed")
 		return nil, err
 	}
-	data, err := ch.getMonitoredData(params[0].(string), updatersMap)
-	ch.log.V(5).Info("MonitorCondSince response", "jsonValue", params[1], "data", data)
+	// the transaction ids are the uuids of the etcd revisions, so the changes since the last transaction of the client
+	// are the changes since its revision
+	var since int64
+	if len(params) == 4 {
+		if lastTxnID, ok := params[3].(string); ok {
+			if since, err = uuidRevision(lastTxnID); err != nil {
+				ch.log.V(5).Info("MonitorCondSince unknown last-txn-id", "last-txn-id", lastTxnID, "reason", err.Error())
+				since, err = 0, nil
+			}
+		}
+	}
+	var data ovsjson.TableUpdates
+	var revision int64
+	found := false
+	if since > 0 {
+		data, revision, found, err = ch.getMonitoredChanges(params[0].(string), updatersMap, since)
+	}
+	if err == nil && !found {
+		if data, err = ch.getMonitoredData(params[0].(string), updatersMap); err == nil {
+			ch.mu.Lock()
+			monitor := ch.monitors[params[0].(string)]
+			ch.mu.Unlock()
+			revision = monitor.revChecker.getRevision()
+		}
+	}
+	ch.log.V(5).Info("MonitorCondSince response", "jsonValue", params[1], "found", found, "data", data)
 	if err != nil {
 		ch.log.Error(err, "failed to get monitored data")
 		ch.removeMonitor(params[1], false)
@@ -290,7 +613,7 @@ func (ch *Handler) MonitorCondSince(ctx context.Context, params []interface{}) (
 	}
 	jsonValueString := jsonValueToString(params[1])
 	ch.startNotifier(jsonValueString)
-	return []interface{}{false, ovsjson.ZERO_UUID, data}, nil
+	return []interface{}{found, revisionUUID(revision), data}, nil
 }
 
 func (ch *Handler) SetDbChangeAware(ctx context.Context, param interface{}) interface{} {
@@ -312,6 +635,7 @@ func NewHandler(tctx context.Context, db Databaser, cli *clientv3.Client, log lo
 		handlerContext:     tctx,
 		db:                 db,
 		databaseLocks:      map[string]Locker{},
+		transactions:       map[string]context.CancelFunc{},
 		handlerMonitorData: map[string]handlerMonitorData{},
 		etcdClient:         cli,
 		monitors:           map[string]*dbMonitor{},
@@ -326,6 +650,7 @@ func (ch *Handler) Cleanup() error {
 	ch.closed = true
 	for _, m := range ch.databaseLocks {
 		m.unlock()
+		m.cancel()
 	}
 
 	for _, monitor := range ch.monitors {
@@ -340,18 +665,85 @@ func (ch *Handler) SetConnection(jrpcSerer JrpcServer, clientCon net.Conn) {
 	ch.log = ch.log.WithValues("client", ch.GetClientAddress())
 }
 
-func (ch *Handler) notify(jsonValueString string, updates ovsjson.TableUpdates, wg *sync.WaitGroup) {
+// notify queues the updates of the events for the notifier of the json-value, the caller holds the lock of the monitor
+func (ch *Handler) notify(jsonValueString string, revision int64, updates ovsjson.TableUpdates, wg *sync.WaitGroup) {
+	event := &notificationEvent{revision: revision, firstRevision: revision, updates: updates}
+	if wg != nil {
+		event.wgs = []*sync.WaitGroup{wg}
+	}
+	ch.pushNotification(jsonValueString, event)
+}
+
+// notifyConditionChange queues the updates of a monitor_cond_change request, the caller holds the lock of the monitor
+func (ch *Handler) notifyConditionChange(jsonValueString string, revision int64, updates ovsjson.TableUpdates) {
+	ch.pushNotification(jsonValueString, &notificationEvent{revision: revision, firstRevision: revision, updates: updates, conditionChange: true})
+}
+
+func (ch *Handler) pushNotification(jsonValueString string, event *notificationEvent) {
 	hmd, ok := ch.handlerMonitorData[jsonValueString]
 	if !ok {
 		ch.log.Info("Unknown jsonValue", "jsonValue", jsonValueString)
+		event.done()
+		return
+	}
+	if ch.handlerContext.Err() != nil {
+		event.done()
 		return
 	}
 	if klog.V(7).Enabled() {
-		ch.log.V(7).Info("Monitor notification jsonValue", "jsonValue", hmd.jsonValue, "updates", updates)
+		ch.log.V(7).Info("Monitor notification jsonValue", "jsonValue", hmd.jsonValue, "updates", event.updates)
 	} else {
 		ch.log.V(5).Info("Monitor notification jsonValue", "jsonValue", hmd.jsonValue)
 	}
-	hmd.notificationChain <- notificationEvent{updates: updates, wg: wg}
+	event.jsonValue = hmd.jsonValue
+	hmd.notifications.push(event)
+}
+
+// resyncNotification returns the notification that replaces the discarded notifications of a slow client, it has the
+// changes of the monitored rows since the first discarded notification until the last notified revision. It returns
+// nil if the monitor was canceled in the meantime.
+func (ch *Handler) resyncNotification(dbName string, queue *notificationQueue, discarded *notificationEvent) (*notificationEvent, error) {
+	ch.mu.Lock()
+	monitor, ok := ch.monitors[dbName]
+	ch.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("there is no monitor for %s", dbName)
+	}
+	// the following notifications are queued after the resync
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	revision := monitor.revChecker.getRevision()
+
+	jsonValueString := jsonValueToString(discarded.jsonValue)
+	updatersMap := Key2Updaters{}
+	keys := []common.Key{}
+	for key, updaters := range monitor.key2Updaters {
+		for _, u := range updaters {
+			if u.jasonValueStr == jsonValueString {
+				updatersMap[key] = append(updatersMap[key], u)
+			}
+		}
+		if len(updatersMap[key]) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	prevResp, err := ch.db.GetDataAtRevision(keys, discarded.firstRevision-1)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ch.db.GetDataAtRevision(keys, revision)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := ch.monitoredChanges(updatersMap, prevResp, resp)
+	if err != nil {
+		return nil, err
+	}
+	event := &notificationEvent{jsonValue: discarded.jsonValue, revision: revision, firstRevision: discarded.firstRevision, updates: updates}
+	if !queue.resynced(discarded, event) {
+		return nil, nil
+	}
+	return event, nil
 }
 
 func (ch *Handler) monitorCanceledNotification(jsonValue interface{}) {
@@ -381,6 +773,7 @@ func (ch *Handler) removeMonitor(jsonValue interface{}, notify bool) error {
 	}
 
 	monitor.removeUpdaters(monitorData.updatersKeys, jsonValueString)
+	monitorData.notifications.close()
 
 	if !monitor.hasUpdaters() {
 		monitor.cancel()
@@ -393,6 +786,25 @@ func (ch *Handler) removeMonitor(jsonValue interface{}, notify bool) error {
 	return nil
 }
 
+// cancelDbMonitor removes the client monitors of a dbMonitor that was unsubscribed from the watch, and notifies the
+// client that they were canceled.
+func (ch *Handler) cancelDbMonitor(monitor *dbMonitor) {
+	var jsonValues []interface{}
+	ch.mu.Lock()
+	for _, monitorData := range ch.handlerMonitorData {
+		if ch.monitors[monitorData.dataBaseName] == monitor {
+			jsonValues = append(jsonValues, monitorData.jsonValue)
+		}
+	}
+	ch.mu.Unlock()
+	for _, jsonValue := range jsonValues {
+		ch.log.Info("cancel monitor, its watch was stopped", "jsonValue", jsonValue)
+		if err := ch.removeMonitor(jsonValue, false); err == nil {
+			ch.monitorCanceledNotification(jsonValue)
+		}
+	}
+}
+
 func (ch *Handler) addMonitor(params []interface{}, notificationType ovsjson.UpdateNotificationType) (Key2Updaters, error) {
 
 	cmpr, err := parseCondMonitorParameters(params)
@@ -409,19 +821,23 @@ func (ch *Handler) addMonitor(params []interface{}, notificationType ovsjson.Upd
 	if _, ok := ch.handlerMonitorData[jsonValueString]; ok {
 		return nil, fmt.Errorf("duplicate monitor ID")
 	}
+	log := ch.log.WithValues("jsonValue", cmpr.JsonValue)
 	updatersMap := Key2Updaters{}
 	var updatersKeys []common.Key
 	for tableName, mcrs := range cmpr.MonitorCondRequests {
 		var updaters []updater
+		tableSchema := ch.monitorTableSchema(cmpr.DatabaseName, tableName)
 		for _, mcr := range mcrs {
-			updater := mcrToUpdater(mcr, jsonValueString, notificationType == ovsjson.Update)
+			updater, err := mcrToUpdater(mcr, jsonValueString, notificationType == ovsjson.Update, tableSchema, log)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %s", tableName, err.Error())
+			}
 			updaters = append(updaters, *updater)
 		}
 		key := common.NewTableKey(cmpr.DatabaseName, tableName)
 		updatersMap[key] = updaters
 		updatersKeys = append(updatersKeys, key)
 	}
-	log := ch.log.WithValues("jsonValue", cmpr.JsonValue)
 	monitor, ok := ch.monitors[cmpr.DatabaseName]
 	if !ok {
 		monitor = ch.db.CreateMonitor(cmpr.DatabaseName, ch, log)
@@ -430,17 +846,28 @@ func (ch *Handler) addMonitor(params []interface{}, notificationType ovsjson.Upd
 	}
 	monitor.addUpdaters(updatersMap)
 	ch.handlerMonitorData[jsonValueString] = handlerMonitorData{
-		log:               log,
-		dataBaseName:      cmpr.DatabaseName,
-		notificationType:  notificationType,
-		updatersKeys:      updatersKeys,
-		jsonValue:         cmpr.JsonValue,
-		notificationChain: make(chan notificationEvent),
+		log:              log,
+		dataBaseName:     cmpr.DatabaseName,
+		notificationType: notificationType,
+		updatersKeys:     updatersKeys,
+		jsonValue:        cmpr.JsonValue,
+		notifications:    newNotificationQueue(cmpr.JsonValue),
 	}
 
 	return updatersMap, nil
 }
 
+// monitorTableSchema returns the schema of a monitored table, or nil if the schema is unknown. The schema is required
+// to evaluate the where conditions.
+func (ch *Handler) monitorTableSchema(dbName, tableName string) *libovsdb.TableSchema {
+	schemas := ch.db.GetSchemas()
+	tableSchema, err := schemas.LookupTable(dbName, tableName)
+	if err != nil {
+		return nil
+	}
+	return tableSchema
+}
+
 func (ch *Handler) startNotifier(jsonValue string) {
 	ch.log.V(6).Info("start monitor notifier", "jsonValue", jsonValue)
 	hmd, ok := ch.handlerMonitorData[jsonValue]
@@ -486,8 +913,9 @@ func (ch *Handler) getMonitoredData(dbName string, updatersMap Key2Updaters) (ov
 			}
 			tableKey := key.ToTableKey()
 			updaters := updatersMap[tableKey]
+			monitorRow := newMonitorRow(kv)
 			for _, updater := range updaters {
-				row, uuid, err := updater.prepareCreateRowInitial(&kv.Value)
+				row, uuid, err := updater.prepareCreateRowInitial(monitorRow)
 				if err != nil {
 					ch.log.Error(err, "prepareCreateRowInitial returned")
 					return nil, err
@@ -501,7 +929,7 @@ func (ch *Handler) getMonitoredData(dbName string, updatersMap Key2Updaters) (ov
 					}
 					tableUpdate[uuid] = *row
 				} else {
-					ch.log.Info("row is nil")
+					ch.log.V(6).Info("row is nil")
 				}
 			}
 		}
@@ -511,11 +939,104 @@ func (ch *Handler) getMonitoredData(dbName string, updatersMap Key2Updaters) (ov
 		err := fmt.Errorf("there is no monitor for %s", dbName)
 		return nil, err
 	}
-	monitor.revChecker.revision = resp.Header.Revision
+	monitor.revChecker.setRevision(resp.Header.Revision)
 	ch.log.V(6).Info("getMonitoredData completed", "revision", resp.Header.Revision, "data", returnData)
 	return returnData, nil
 }
 
+// getMonitoredChanges returns the changes of the monitored rows since the revision, and the current revision. The
+// monitored tables are read at the revision and at the current revision, and every changed row is reported once, by
+// the difference between its values. It returns false if the revision is compacted or unknown.
+func (ch *Handler) getMonitoredChanges(dbName string, updatersMap Key2Updaters, since int64) (ovsjson.TableUpdates, int64, bool, error) {
+	keys := []common.Key{}
+	for tableKey, updaters := range updatersMap {
+		if len(updaters) > 0 {
+			keys = append(keys, tableKey)
+		}
+	}
+	resp, err := ch.db.GetData(keys)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if since > resp.Header.Revision {
+		ch.log.V(5).Info("getMonitoredChanges unknown revision", "revision", since, "current-revision", resp.Header.Revision)
+		return nil, 0, false, nil
+	}
+	prevResp, err := ch.db.GetDataAtRevision(keys, since)
+	if err == rpctypes.ErrCompacted {
+		ch.log.V(5).Info("getMonitoredChanges compacted revision", "revision", since)
+		return nil, 0, false, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	returnData, err := ch.monitoredChanges(updatersMap, prevResp, resp)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	monitor, ok := ch.monitors[dbName]
+	if !ok {
+		err := fmt.Errorf("there is no monitor for %s", dbName)
+		return nil, 0, false, err
+	}
+	monitor.revChecker.setRevision(resp.Header.Revision)
+	ch.log.V(6).Info("getMonitoredChanges completed", "revision", since, "current-revision", resp.Header.Revision, "data", returnData)
+	return returnData, resp.Header.Revision, true, nil
+}
+
+// monitoredChanges returns the updates of the monitored rows from their values in the previous response to their
+// values in the response
+func (ch *Handler) monitoredChanges(updatersMap Key2Updaters, prevResp, resp *clientv3.TxnResponse) (ovsjson.TableUpdates, error) {
+	prevRows := map[string]*monitorRow{}
+	for _, opRes := range prevResp.Responses {
+		for _, kv := range opRes.GetResponseRange().Kvs {
+			prevRows[string(kv.Key)] = newMonitorRow(kv)
+		}
+	}
+	returnData := ovsjson.TableUpdates{}
+	addRowUpdate := func(etcdKey []byte, prevRow, currentRow *monitorRow) error {
+		key, err := common.ParseKey(string(etcdKey))
+		if err != nil {
+			ch.log.Error(err, "parse failed", "key", string(etcdKey))
+			return err
+		}
+		tableKey := key.ToTableKey()
+		for _, updater := range updatersMap[tableKey] {
+			row, uuid, err := updater.prepareChangeRowUpdate(prevRow, currentRow)
+			if err != nil {
+				ch.log.Error(err, "prepareChangeRowUpdate returned")
+				return err
+			}
+			if row == nil {
+				continue
+			}
+			tableUpdate, ok := returnData[tableKey.TableName]
+			if !ok {
+				tableUpdate = ovsjson.TableUpdate{}
+				returnData[tableKey.TableName] = tableUpdate
+			}
+			tableUpdate[uuid] = *row
+		}
+		return nil
+	}
+	for _, opRes := range resp.Responses {
+		for _, kv := range opRes.GetResponseRange().Kvs {
+			prevRow := prevRows[string(kv.Key)]
+			delete(prevRows, string(kv.Key))
+			if err := addRowUpdate(kv.Key, prevRow, newMonitorRow(kv)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// the remaining rows were deleted
+	for _, prevRow := range prevRows {
+		if err := addRowUpdate(prevRow.kv.Key, prevRow, nil); err != nil {
+			return nil, err
+		}
+	}
+	return returnData, nil
+}
+
 func (ch *Handler) GetClientAddress() string {
 	if ch.clientCon != nil {
 		return ch.clientCon.RemoteAddr().String()
@@ -0,0 +1,232 @@
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// the interval of the progress requests of the history watch, the watch is completed by a progress notification
+var historyProgressInterval = 100 * time.Millisecond
+
+// the number of the unanswered progress requests before the history watch is restarted
+var historyProgressRequests = 10
+
+const (
+	HISTORY_INSERT = "insert"
+	HISTORY_MODIFY = "modify"
+	HISTORY_DELETE = "delete"
+)
+
+// TransactionRecord is the metadata of a transaction, it is the value of the transaction key (see
+// common.NewTransactionKey) at the revision of the transaction.
+type TransactionRecord struct {
+	DBName    string   `json:"db"`
+	Timestamp string   `json:"timestamp"`
+	Comments  []string `json:"comments,omitempty"`
+}
+
+// RowVersion is a version of a row, as it was written at an etcd revision
+type RowVersion struct {
+	Revision int64  `json:"revision"`
+	Change   string `json:"change"`
+	// the timestamp and the comments of the transaction that wrote the version, they are missing for the rows that
+	// were written by the server itself (e.g. the reset of the ephemeral columns)
+	Timestamp string   `json:"timestamp,omitempty"`
+	Comments  []string `json:"comments,omitempty"`
+	// the row, except for a deleted row
+	Row map[string]interface{} `json:"row,omitempty"`
+	// the modified columns of a modified row, in the format of the "modify" member of <row-update2> (see columnDiff)
+	Diff map[string]interface{} `json:"diff,omitempty"`
+}
+
+// RowHistory is the history of a row up to the revision
+type RowHistory struct {
+	Revision int64 `json:"revision"`
+	// the history before the compact revision is not available
+	CompactRevision int64        `json:"compact_revision,omitempty"`
+	Versions        []RowVersion `json:"versions"`
+}
+
+// etcdMarkTransaction puts the record of the transaction, if it modifies the data
+func (txn *Transaction) etcdMarkTransaction() error {
+	if len(txn.etcd.Events) == 0 {
+		return nil
+	}
+	record := TransactionRecord{
+		DBName:    txn.request.DBName,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Comments:  txn.comments,
+	}
+	val, err := json.Marshal(record)
+	if err != nil {
+		txn.log.Error(err, "failed to marshal transaction record")
+		return errors.New(E_INTERNAL_ERROR)
+	}
+	key := common.NewTransactionKey()
+	txn.etcd.Then = append(txn.etcd.Then, clientv3.OpPut(key.String(), string(val)))
+	txn.etcd.EventsNilCount++
+	txn.etcd.Assert()
+	return nil
+}
+
+// GetRowHistory returns the versions of the row that are kept by etcd, i.e. since the last compaction. The history
+// is read by a watch of the row key from the first revision, until a progress notification confirms that all the
+// events up to the current revision were received.
+func GetRowHistory(ctx context.Context, cli *clientv3.Client, tableSchema *libovsdb.TableSchema, key common.Key) (*RowHistory, error) {
+	res, err := cli.Get(ctx, key.String(), clientv3.WithCountOnly())
+	if err != nil {
+		return nil, err
+	}
+	history := &RowHistory{Revision: res.Header.Revision, Versions: []RowVersion{}}
+
+	/* each watch has its own watcher, i.e. its own grpc stream, because etcd notifies the progress of a stream only
+	 * when all its watchers are synced, and a compacted watcher is never synced */
+	var (
+		watcher  clientv3.Watcher
+		wctx     = clientv3.WithRequireLeader(ctx)
+		wch      clientv3.WatchChan
+		requests int
+		// the first revision that was not received yet
+		revision int64 = 1
+	)
+	defer func() { watcher.Close() }()
+	watch := func() {
+		if watcher != nil {
+			watcher.Close()
+		}
+		requests = 0
+		watcher = clientv3.NewWatcher(cli)
+		wch = watcher.Watch(wctx, key.String(), clientv3.WithRev(revision), clientv3.WithPrevKV())
+	}
+	watch()
+	ticker := time.NewTicker(historyProgressInterval)
+	defer ticker.Stop()
+	var prevRow map[string]interface{}
+	for {
+		select {
+		case <-ticker.C:
+			if requests >= historyProgressRequests {
+				/* etcd defers the progress requests that are received before the watch is synced, until the next
+				 * event, watch again the remaining revisions */
+				watch()
+				continue
+			}
+			requests++
+			if err = watcher.RequestProgress(wctx); err != nil {
+				return nil, err
+			}
+		case wresp, ok := <-wch:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, errors.New("history watch closed")
+			}
+			if wresp.CompactRevision != 0 {
+				/* the history before the compaction is not available, watch from the compact revision */
+				history.CompactRevision = wresp.CompactRevision
+				revision = wresp.CompactRevision
+				watch()
+				continue
+			}
+			if err = wresp.Err(); err != nil {
+				return nil, err
+			}
+			for _, ev := range wresp.Events {
+				if ev.Kv.ModRevision > history.Revision {
+					return history, nil
+				}
+				version, err := rowVersion(ctx, cli, tableSchema, ev, prevRow)
+				if err != nil {
+					return nil, err
+				}
+				history.Versions = append(history.Versions, *version)
+				prevRow = version.Row
+				if ev.Kv.ModRevision == history.Revision {
+					return history, nil
+				}
+				revision = ev.Kv.ModRevision + 1
+			}
+			if wresp.IsProgressNotify() && wresp.Header.Revision >= history.Revision {
+				return history, nil
+			}
+		}
+	}
+}
+
+// rowVersion returns the version of the row that was written by the event, prevRow is the previous version if it is
+// known.
+func rowVersion(ctx context.Context, cli *clientv3.Client, tableSchema *libovsdb.TableSchema, ev *clientv3.Event, prevRow map[string]interface{}) (*RowVersion, error) {
+	version := &RowVersion{Revision: ev.Kv.ModRevision}
+	record, err := transactionRecord(ctx, cli, ev.Kv.ModRevision)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		version.Timestamp = record.Timestamp
+		version.Comments = record.Comments
+	}
+	if ev.Type == mvccpb.DELETE {
+		version.Change = HISTORY_DELETE
+		return version, nil
+	}
+	if version.Row, err = validatorRow(tableSchema, ev.Kv.Value); err != nil {
+		return nil, err
+	}
+	if ev.IsCreate() {
+		version.Change = HISTORY_INSERT
+		return version, nil
+	}
+	version.Change = HISTORY_MODIFY
+	if ev.PrevKv != nil {
+		if prevRow, err = validatorRow(tableSchema, ev.PrevKv.Value); err != nil {
+			return nil, err
+		}
+	}
+	if prevRow == nil {
+		/* the previous version was compacted */
+		return version, nil
+	}
+	version.Diff = map[string]interface{}{}
+	for column, value := range version.Row {
+		columnSchema, err := tableSchema.LookupColumn(column)
+		if err != nil {
+			return nil, err
+		}
+		prevValue := prevRow[column]
+		if isEqualValue(prevValue, value) {
+			continue
+		}
+		if prevValue != nil && isEqualColumn(columnSchema, prevValue, value) && isEqualColumn(columnSchema, value, prevValue) {
+			continue
+		}
+		version.Diff[column] = columnDiff(columnSchema, prevValue, value)
+	}
+	return version, nil
+}
+
+// transactionRecord returns the record of the transaction that was committed at the revision, or nil if the
+// transaction has no record
+func transactionRecord(ctx context.Context, cli *clientv3.Client, revision int64) (*TransactionRecord, error) {
+	key := common.NewTransactionKey()
+	res, err := cli.Get(ctx, key.String(), clientv3.WithRev(revision))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Kvs) == 0 || res.Kvs[0].ModRevision != revision {
+		return nil, nil
+	}
+	record := &TransactionRecord{}
+	if err = json.Unmarshal(res.Kvs[0].Value, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
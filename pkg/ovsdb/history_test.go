@@ -0,0 +1,123 @@
+package ovsdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+func TestHistoryRow(t *testing.T) {
+	table := "table1"
+	comment := "insert row1"
+	row1 := map[string]interface{}{
+		"key1": "val1",
+		"key2": 1,
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+			},
+			{
+				Op:      OP_COMMENT,
+				Comment: &comment,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	uuid := resp.Result[0].UUID.GoUUID
+
+	row2 := map[string]interface{}{
+		"key1": "val2",
+	}
+	req = &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row2,
+				Where: &[]interface{}{},
+			},
+		},
+	}
+	resp, _ = testTransact(t, req)
+	assert.Nil(t, resp.Error)
+
+	req = &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+				Where: &[]interface{}{},
+			},
+		},
+	}
+	resp, _ = testTransact(t, req)
+	assert.Nil(t, resp.Error)
+
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	tableSchema, err := testSchemaSimple.LookupTable(table)
+	assert.Nil(t, err)
+	history, err := GetRowHistory(context.Background(), cli, tableSchema, common.NewDataKey("simple", table, uuid))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history.Versions))
+
+	assert.Equal(t, HISTORY_INSERT, history.Versions[0].Change)
+	assert.Equal(t, []string{comment}, history.Versions[0].Comments)
+	assert.NotEqual(t, "", history.Versions[0].Timestamp)
+	assert.Equal(t, "val1", history.Versions[0].Row["key1"])
+
+	assert.Equal(t, HISTORY_MODIFY, history.Versions[1].Change)
+	assert.Nil(t, history.Versions[1].Comments)
+	assert.NotEqual(t, "", history.Versions[1].Timestamp)
+	assert.Equal(t, map[string]interface{}{"key1": "val2"}, history.Versions[1].Diff)
+
+	assert.Equal(t, HISTORY_DELETE, history.Versions[2].Change)
+	assert.Nil(t, history.Versions[2].Row)
+	assert.True(t, history.Versions[0].Revision < history.Versions[1].Revision)
+	assert.True(t, history.Versions[1].Revision < history.Versions[2].Revision)
+	assert.True(t, history.Versions[2].Revision <= history.Revision)
+}
+
+func TestHistoryUnknownRow(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	tableSchema, err := testSchemaSimple.LookupTable("table1")
+	assert.Nil(t, err)
+	history, err := GetRowHistory(context.Background(), cli, tableSchema, common.GenerateDataKey("simple", "table1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history.Versions))
+}
+
+func TestHistoryColumnDiff(t *testing.T) {
+	setSchema, err := testSchemaSet.LookupTable("table1")
+	assert.Nil(t, err)
+	oldSet := libovsdb.OvsSet{GoSet: []interface{}{"a", "b"}}
+	newSet := libovsdb.OvsSet{GoSet: []interface{}{"b", "c"}}
+	diff := columnDiff(setSchema.Columns["string"], oldSet, newSet)
+	assert.Equal(t, libovsdb.OvsSet{GoSet: []interface{}{"c", "a"}}, diff)
+
+	mapSchema, err := testSchemaMap.LookupTable("table1")
+	assert.Nil(t, err)
+	oldMap := libovsdb.OvsMap{GoMap: map[interface{}]interface{}{"a": "1", "b": "2", "c": "3"}}
+	newMap := libovsdb.OvsMap{GoMap: map[interface{}]interface{}{"b": "2", "c": "4", "d": "5"}}
+	diff = columnDiff(mapSchema.Columns["string"], oldMap, newMap)
+	assert.Equal(t, libovsdb.OvsMap{GoMap: map[interface{}]interface{}{"a": "1", "c": "4", "d": "5"}}, diff)
+}
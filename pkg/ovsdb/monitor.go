@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,8 +25,12 @@ const (
 )
 
 type updater struct {
-	Columns          map[string]bool
-	Where            [][]string
+	Columns map[string]bool
+	// the where conditions of a conditional monitor, a row is monitored if it satisfies any of them, or if there are
+	// no conditions
+	Where            []interface{}
+	conditions       []*Condition
+	tableSchema      *libovsdb.TableSchema
 	Select           libovsdb.MonitorSelect
 	isV1             bool
 	notificationType ovsjson.UpdateNotificationType
@@ -38,15 +43,26 @@ type handlerMonitorData struct {
 	notificationType ovsjson.UpdateNotificationType
 
 	// updaters from the given json-value, key is the path in the monitor.
-	updatersKeys      []common.Key
-	dataBaseName      string
-	jsonValue         interface{}
-	notificationChain chan notificationEvent
+	updatersKeys  []common.Key
+	dataBaseName  string
+	jsonValue     interface{}
+	notifications *notificationQueue
 }
 
 type notificationEvent struct {
-	updates ovsjson.TableUpdates
-	wg      *sync.WaitGroup
+	// the json-value of the updates, it is changed by a monitor_cond_change request
+	jsonValue interface{}
+	// the revision of the last transaction of the updates, its uuid is the last-txn-id of the update3 notification
+	revision int64
+	// the revision of the first transaction of the updates, the notifications of several transactions can be merged
+	firstRevision int64
+	updates       ovsjson.TableUpdates
+	// the number of the row updates
+	rows int
+	// the updates of a monitor_cond_change request
+	conditionChange bool
+	// the transactions of the connection wait until their updates are sent
+	wgs []*sync.WaitGroup
 }
 
 // Map from a key which represents a table paths (prefix/dbname/table) to arrays of updaters
@@ -74,9 +90,12 @@ func (k *Key2Updaters) removeUpdaters(key common.Key, jsonValue string) {
 type dbMonitor struct {
 	log logr.Logger
 
-	// etcd watcher channel
-	watchChannel clientv3.WatchChan
-	// cancel function to close the etcd watcher
+	// the events of the shared etcd watch of the database (see dbWatcher), until watchDone is closed
+	watchChannel <-chan *monitorEvents
+	watchDone    <-chan struct{}
+	// closed if the monitor missed events of the watch because it didn't read them
+	watchOverflow <-chan struct{}
+	// cancel function to unsubscribe from the etcd watch
 	cancel context.CancelFunc
 
 	mu sync.Mutex
@@ -107,6 +126,18 @@ func (rc *revisionChecker) isNewRevision(newRevision int64) bool {
 	return false
 }
 
+func (rc *revisionChecker) getRevision() int64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.revision
+}
+
+func (rc *revisionChecker) setRevision(revision int64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.revision = revision
+}
+
 func newMonitor(dbName string, handler *Handler, log logr.Logger) *dbMonitor {
 	m := dbMonitor{
 		log:          log,
@@ -149,14 +180,106 @@ func (m *dbMonitor) hasUpdaters() bool {
 	return len(m.key2Updaters) > 0
 }
 
+// jsonValueUpdaters returns the updaters of the table key that belong to the json-value
+func (m *dbMonitor) jsonValueUpdaters(key common.Key, jsonValue string) []updater {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	updaters := []updater{}
+	for _, u := range m.key2Updaters[key] {
+		if u.jasonValueStr == jsonValue {
+			updaters = append(updaters, u)
+		}
+	}
+	return updaters
+}
+
+// changeUpdaters replaces the updaters of the json-value by the given ones, the updaters of the other tables keep
+// their conditions, and all of them are moved to the new json-value. The changed tables are read at the revision of
+// the last notification, and the rows that entered or left the monitored rows are sent to the notifier of the new
+// json-value before any notification of the following events.
+func (m *dbMonitor) changeUpdaters(jsonValue, newJsonValue string, keyToUpdaters Key2Updaters) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revision := m.revChecker.getRevision()
+
+	keys := []common.Key{}
+	for key := range keyToUpdaters {
+		keys = append(keys, key)
+	}
+	resp, err := m.handler.db.GetDataAtRevision(keys, revision)
+	if err != nil {
+		return err
+	}
+	tableUpdates := ovsjson.TableUpdates{}
+	for _, opRes := range resp.Responses {
+		for _, kv := range opRes.GetResponseRange().Kvs {
+			key, err := common.ParseKey(string(kv.Key))
+			if err != nil {
+				return err
+			}
+			row := newMonitorRow(kv)
+			tableKey := key.ToTableKey()
+			oldUpdaters := []updater{}
+			for _, u := range m.key2Updaters[tableKey] {
+				if u.jasonValueStr == jsonValue {
+					oldUpdaters = append(oldUpdaters, u)
+				}
+			}
+			for i, u := range keyToUpdaters[tableKey] {
+				var oldUpdater *updater
+				if i < len(oldUpdaters) {
+					oldUpdater = &oldUpdaters[i]
+				}
+				rowUpdate, uuid, err := u.prepareConditionRowUpdate(oldUpdater, row)
+				if err != nil {
+					return err
+				}
+				if rowUpdate == nil {
+					continue
+				}
+				tableUpdate, ok := tableUpdates[key.TableName]
+				if !ok {
+					tableUpdate = ovsjson.TableUpdate{}
+					tableUpdates[key.TableName] = tableUpdate
+				}
+				tableUpdate[uuid] = *rowUpdate
+			}
+		}
+	}
+
+	for key, updaters := range keyToUpdaters {
+		m.key2Updaters.removeUpdaters(key, jsonValue)
+		m.key2Updaters[key] = append(m.key2Updaters[key], updaters...)
+	}
+	for _, updaters := range m.key2Updaters {
+		for i := range updaters {
+			if updaters[i].jasonValueStr == jsonValue {
+				updaters[i].jasonValueStr = newJsonValue
+			}
+		}
+	}
+	if len(tableUpdates) > 0 {
+		m.handler.notifyConditionChange(newJsonValue, revision, tableUpdates)
+	}
+	return nil
+}
+
 func (m *dbMonitor) start() {
 	go func() {
-		for wresp := range m.watchChannel {
-			if wresp.Canceled {
+		for {
+			select {
+			case <-m.watchDone:
+				return
+			case <-m.watchOverflow:
 				m.cancelDbMonitor()
 				return
+			case wevents := <-m.watchChannel:
+				if wevents.canceled {
+					m.cancelDbMonitor()
+					return
+				}
+				m.notifyEvents(wevents.events, wevents.revision, nil)
 			}
-			m.notify(wresp.Events, wresp.Header.Revision, nil)
 		}
 	}()
 }
@@ -165,45 +288,65 @@ func (hm *handlerMonitorData) notifier(ch *Handler) {
 	// we need some time to allow to the monitor calls return data
 	time.Sleep(5 * time.Millisecond)
 	for {
-		select {
-		case <-ch.handlerContext.Done():
+		notificationEvent, state := hm.notifications.pop(ch.handlerContext)
+		switch state {
+		case queueClosed:
+			// the transactions don't wait for the pending notifications
+			hm.notifications.close()
 			return
-
-		case notificationEvent := <-hm.notificationChain:
-			if ch.handlerContext.Err() != nil {
-				if notificationEvent.wg != nil {
-					notificationEvent.wg.Done()
-				}
-				return
-			}
-			if hm.log.V(6).Enabled() {
-				hm.log.V(6).Info("send notification", "updates", notificationEvent.updates)
-			} else {
-				hm.log.V(5).Info("send notification")
-			}
-
-			var err error
-			switch hm.notificationType {
-			case ovsjson.Update:
-				err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE, []interface{}{hm.jsonValue, notificationEvent.updates})
-			case ovsjson.Update2:
-				err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE2, []interface{}{hm.jsonValue, notificationEvent.updates})
-			case ovsjson.Update3:
-				err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE3, []interface{}{hm.jsonValue, ovsjson.ZERO_UUID, notificationEvent.updates})
+		case queueCanceled:
+			hm.log.Info("cancel monitor, the client doesn't read its notifications", "revision", notificationEvent.revision)
+			if err := ch.removeMonitor(notificationEvent.jsonValue, false); err == nil {
+				ch.monitorCanceledNotification(notificationEvent.jsonValue)
 			}
+			return
+		case queueResync:
+			hm.log.Info("resync monitor, the client doesn't read its notifications", "revision", notificationEvent.firstRevision-1)
+			resyncEvent, err := ch.resyncNotification(hm.dataBaseName, hm.notifications, notificationEvent)
 			if err != nil {
-				// TODO should we do something else
-				hm.log.Error(err, "monitor notification failed")
+				hm.log.Error(err, "monitor resync failed")
+				hm.notifications.cancel()
+				continue
 			}
-			if notificationEvent.wg != nil {
-				hm.log.V(7).Info("sent notification and call wg.done")
-				notificationEvent.wg.Done()
+			if resyncEvent == nil {
+				continue
 			}
+			notificationEvent = resyncEvent
 		}
+		if ch.handlerContext.Err() != nil {
+			notificationEvent.done()
+			return
+		}
+		if hm.log.V(6).Enabled() {
+			hm.log.V(6).Info("send notification", "updates", notificationEvent.updates)
+		} else {
+			hm.log.V(5).Info("send notification")
+		}
+
+		var err error
+		switch hm.notificationType {
+		case ovsjson.Update:
+			err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE, []interface{}{notificationEvent.jsonValue, notificationEvent.updates})
+		case ovsjson.Update2:
+			err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE2, []interface{}{notificationEvent.jsonValue, notificationEvent.updates})
+		case ovsjson.Update3:
+			err = ch.jrpcServer.Notify(ch.handlerContext, UPDATE3, []interface{}{notificationEvent.jsonValue, revisionUUID(notificationEvent.revision), notificationEvent.updates})
+		}
+		if err != nil {
+			// the client missed the updates
+			hm.log.Error(err, "monitor notification failed")
+			hm.notifications.failed(notificationEvent, state == queueResync)
+		}
+		hm.log.V(7).Info("sent notification and call wg.done")
+		notificationEvent.done()
 	}
 }
 
 func (m *dbMonitor) notify(events []*clientv3.Event, revision int64, wg *sync.WaitGroup) {
+	m.notifyEvents(decodeEvents(events, m.log), revision, wg)
+}
+
+func (m *dbMonitor) notifyEvents(events []*monitorEvent, revision int64, wg *sync.WaitGroup) {
 	var sentToNotifier bool
 	defer func() {
 		if wg != nil && !sentToNotifier {
@@ -213,7 +356,11 @@ func (m *dbMonitor) notify(events []*clientv3.Event, revision int64, wg *sync.Wa
 	if len(events) == 0 {
 		m.log.V(5).Info("there is events")
 	}
-	m.log.V(5).Info("notify", "revChecker.revision", m.revChecker.revision, "revision", revision, "wg == nil", wg == nil)
+	// the updaters are not changed until the updates are passed to the notifiers, so the updates of a condition change
+	// are ordered with the updates of the events
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.log.V(5).Info("notify", "revChecker.revision", m.revChecker.getRevision(), "revision", revision, "wg == nil", wg == nil)
 	if m.revChecker.isNewRevision(revision) {
 		result, err := m.prepareTableUpdate(events)
 		if err != nil {
@@ -223,57 +370,121 @@ func (m *dbMonitor) notify(events []*clientv3.Event, revision int64, wg *sync.Wa
 				m.log.V(5).Info("there is nothing to notify", "events", events)
 				return
 			}
+			// the header revision can be greater than the revision of the events
+			txnRevision := revision
+			for _, ev := range events {
+				if ev.Kv != nil && ev.Kv.ModRevision > 0 && ev.Kv.ModRevision <= revision {
+					txnRevision = ev.Kv.ModRevision
+				}
+			}
+			if wg != nil {
+				// every notifier calls wg.Done
+				wg.Add(len(result) - 1)
+			}
 			for jValue, tableUpdates := range result {
 				sentToNotifier = true
 				m.log.V(7).Info("notify", "table-update", tableUpdates)
-				m.handler.notify(jValue, tableUpdates, wg)
+				m.handler.notify(jValue, txnRevision, tableUpdates, wg)
 			}
 		}
 	} else {
-		m.log.V(5).Info("revisionChecker returned false", "old-revision", m.revChecker.revision, "notification-revision", revision)
+		m.log.V(5).Info("revisionChecker returned false", "old-revision", m.revChecker.getRevision(), "notification-revision", revision)
 	}
 
 }
 
+// cancelDbMonitor unsubscribes the monitor from the watch, and cancels the client monitors of its updaters.
 func (m *dbMonitor) cancelDbMonitor() {
 	m.cancel()
-	jasonValues := map[string]string{}
-	m.mu.Lock()
-	for _, updaters := range m.key2Updaters {
-		for _, updater := range updaters {
-			jasonValues[updater.jasonValueStr] = updater.jasonValueStr
-		}
-	}
-	m.key2Updaters = Key2Updaters{}
-	m.mu.Unlock()
-	for jsonValue := range jasonValues {
-		m.handler.monitorCanceledNotification(jsonValue)
-	}
+	m.handler.cancelDbMonitor(m)
 }
 
-func mcrToUpdater(mcr ovsjson.MonitorCondRequest, jsonValue string, isV1 bool) *updater {
-
-	//TODO  handle "Where"
+func mcrToUpdater(mcr ovsjson.MonitorCondRequest, jsonValue string, isV1 bool, tableSchema *libovsdb.TableSchema, log logr.Logger) (*updater, error) {
 	if mcr.Select == nil {
 		mcr.Select = &libovsdb.MonitorSelect{}
 	}
-	return &updater{Columns: common.StringArrayToMap(mcr.Columns), jasonValueStr: jsonValue, isV1: isV1, Select: *mcr.Select}
+	u := &updater{Columns: common.StringArrayToMap(mcr.Columns), jasonValueStr: jsonValue, isV1: isV1, Select: *mcr.Select}
+	if err := u.setWhere(mcr.Where, tableSchema, log); err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
-func (m *dbMonitor) prepareTableUpdate(events []*clientv3.Event) (map[string]ovsjson.TableUpdates, error) {
-	result := map[string]ovsjson.TableUpdates{}
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	for _, ev := range events {
-		if ev.Kv == nil {
-			m.log.V(5).Info("empty etcd event", "event", fmt.Sprintf("%+v", ev))
-			continue
+// setWhere sets the where conditions of the updater. The conditions are evaluated by the condition engine of the
+// transactions, in addition a condition can be a boolean value. An empty array of conditions stands for true.
+func (u *updater) setWhere(where interface{}, tableSchema *libovsdb.TableSchema, log logr.Logger) error {
+	u.Where = nil
+	u.conditions = nil
+	u.tableSchema = nil
+	if where == nil {
+		return nil
+	}
+	conds, ok := where.([]interface{})
+	if !ok {
+		return fmt.Errorf("wrong where type %T, expected array of conditions", where)
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+	/* the conditions use the transaction only for logging */
+	txn := &Transaction{log: log}
+	conditions := []*Condition{}
+	for _, c := range conds {
+		switch cond := c.(type) {
+		case bool:
+			if cond {
+				/* a true condition selects all the rows */
+				return nil
+			}
+		case []interface{}:
+			if tableSchema == nil {
+				return fmt.Errorf("missing table schema of the where conditions")
+			}
+			condition, err := NewCondition(txn, tableSchema, MapUUID{}, cond)
+			if err != nil {
+				return fmt.Errorf("wrong condition %v: %s", cond, err.Error())
+			}
+			conditions = append(conditions, condition)
+		default:
+			return fmt.Errorf("wrong condition type %T", c)
 		}
-		key, err := common.ParseKey(string(ev.Kv.Key))
+	}
+	u.Where = conds
+	u.conditions = conditions
+	u.tableSchema = tableSchema
+	return nil
+}
+
+// isRowSelected returns true if the stored row satisfies the where conditions of the updater
+func (u *updater) isRowSelected(row *monitorRow) (bool, error) {
+	if u.Where == nil {
+		return true, nil
+	}
+	if len(u.conditions) == 0 {
+		/* the conditions are false */
+		return false, nil
+	}
+	nativeRow, err := row.nativeRow(u.tableSchema)
+	if err != nil {
+		return false, err
+	}
+	for _, condition := range u.conditions {
+		ok, err := condition.Compare(&nativeRow)
 		if err != nil {
-			m.log.Error(err, "parseKey failed")
-			continue
+			return false, err
+		}
+		if ok {
+			return true, nil
 		}
+	}
+	return false, nil
+}
+
+// prepareTableUpdate returns the updates of the events by the json-values of the updaters, the caller holds m.mu
+func (m *dbMonitor) prepareTableUpdate(events []*monitorEvent) (map[string]ovsjson.TableUpdates, error) {
+	result := map[string]ovsjson.TableUpdates{}
+	for _, ev := range events {
+		key := ev.key
 		updaters, ok := m.key2Updaters[key.ToTableKey()]
 		if !ok {
 			m.log.Info("no monitors for table path", "table-path", key.TableKeyString())
@@ -313,37 +524,109 @@ func (m *dbMonitor) prepareTableUpdate(events []*clientv3.Event) (map[string]ovs
 	return result, nil
 }
 
-func (u *updater) prepareRowUpdate(event *clientv3.Event) (*ovsjson.RowUpdate, string, error) {
+func (u *updater) prepareRowUpdate(event *monitorEvent) (*ovsjson.RowUpdate, string, error) {
 	if !event.IsModify() { // the create or delete
 		if event.IsCreate() {
 			// Create event
-			return u.prepareCreateRowUpdate(event)
+			if selected, err := u.isRowSelected(event.row); err != nil || !selected {
+				return nil, "", err
+			}
+			return u.prepareCreateRowUpdate(event.row)
 		} else {
 			// Delete event
-			return u.prepareDeleteRowUpdate(event)
+			if selected, err := u.isRowSelected(event.prevRow); err != nil || !selected {
+				return nil, "", err
+			}
+			return u.prepareDeleteRowUpdate(event.prevRow)
 		}
 	}
 	// the event is modify
-	return u.prepareModifyRowUpdate(event)
+	return u.prepareSelectedRowUpdate(event.row, event.prevRow)
+}
+
+// prepareSelectedRowUpdate returns the update of a modified row, according to the selection of its previous and new
+// values by the where conditions
+func (u *updater) prepareSelectedRowUpdate(row, prevRow *monitorRow) (*ovsjson.RowUpdate, string, error) {
+	selected, err := u.isRowSelected(row)
+	if err != nil {
+		return nil, "", err
+	}
+	prevSelected, err := u.isRowSelected(prevRow)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case selected && prevSelected:
+		return u.prepareModifyRowUpdate(row, prevRow)
+	case selected:
+		// the row was modified to satisfy the conditions, it is reported as inserted
+		return u.prepareCreateRowUpdate(row)
+	case prevSelected:
+		// the row was modified not to satisfy the conditions, it is reported as deleted
+		return u.prepareDeleteRowUpdate(prevRow)
+	}
+	return nil, "", nil
 }
 
-func (u *updater) prepareDeleteRowUpdate(event *clientv3.Event) (*ovsjson.RowUpdate, string, error) {
+// prepareChangeRowUpdate returns the update of a row from its value at a previous revision to its current value, the
+// previous value is nil for an inserted row and the current one is nil for a deleted row
+func (u *updater) prepareChangeRowUpdate(prevRow, row *monitorRow) (*ovsjson.RowUpdate, string, error) {
+	switch {
+	case prevRow == nil:
+		if selected, err := u.isRowSelected(row); err != nil || !selected {
+			return nil, "", err
+		}
+		return u.prepareCreateRowUpdate(row)
+	case row == nil:
+		if selected, err := u.isRowSelected(prevRow); err != nil || !selected {
+			return nil, "", err
+		}
+		return u.prepareDeleteRowUpdate(prevRow)
+	case row.kv.ModRevision == prevRow.kv.ModRevision:
+		return nil, "", nil
+	}
+	return u.prepareSelectedRowUpdate(row, prevRow)
+}
+
+// prepareConditionRowUpdate returns the update of a row after the conditions of the old updater were replaced by the
+// conditions of the updater. A row that starts to satisfy the conditions is reported as inserted, and a row that stops
+// to satisfy them as deleted. The old updater is nil for a table that was not monitored.
+func (u *updater) prepareConditionRowUpdate(oldUpdater *updater, row *monitorRow) (*ovsjson.RowUpdate, string, error) {
+	selected, err := u.isRowSelected(row)
+	if err != nil {
+		return nil, "", err
+	}
+	prevSelected := false
+	if oldUpdater != nil {
+		if prevSelected, err = oldUpdater.isRowSelected(row); err != nil {
+			return nil, "", err
+		}
+	}
+	switch {
+	case selected && !prevSelected:
+		return u.prepareCreateRowUpdate(row)
+	case !selected && prevSelected:
+		return u.prepareDeleteRowUpdate(row)
+	}
+	return nil, "", nil
+}
+
+func (u *updater) prepareDeleteRowUpdate(prevRow *monitorRow) (*ovsjson.RowUpdate, string, error) {
 	// Delete event
 	if !libovsdb.MSIsTrue(u.Select.Delete) {
 		return nil, "", nil
 	}
-	value := event.PrevKv.Value
 	if !u.isV1 {
 		// according to https://docs.openvswitch.org/en/latest/ref/ovsdb-server.7/#update2-notification,
 		// "<row> is always a null object for a delete update."
-		_, uuid, err := u.prepareRow(value)
+		_, uuid, err := u.prepareRow(prevRow)
 		if err != nil {
 			return nil, "", err
 		}
 		return &ovsjson.RowUpdate{Delete: true}, uuid, nil
 	}
 
-	data, uuid, err := u.prepareRow(value)
+	data, uuid, err := u.prepareRow(prevRow)
 	if err != nil {
 		return nil, "", err
 	}
@@ -354,13 +637,12 @@ func (u *updater) prepareDeleteRowUpdate(event *clientv3.Event) (*ovsjson.RowUpd
 	return nil, uuid, nil
 }
 
-func (u *updater) prepareCreateRowUpdate(event *clientv3.Event) (*ovsjson.RowUpdate, string, error) {
+func (u *updater) prepareCreateRowUpdate(row *monitorRow) (*ovsjson.RowUpdate, string, error) {
 	// the event is create
 	if !libovsdb.MSIsTrue(u.Select.Insert) {
 		return nil, "", nil
 	}
-	value := event.Kv.Value
-	data, uuid, err := u.prepareRow(value)
+	data, uuid, err := u.prepareRow(row)
 	if err != nil {
 		return nil, "", err
 	}
@@ -373,16 +655,16 @@ func (u *updater) prepareCreateRowUpdate(event *clientv3.Event) (*ovsjson.RowUpd
 	return nil, "", nil
 }
 
-func (u *updater) prepareModifyRowUpdate(event *clientv3.Event) (*ovsjson.RowUpdate, string, error) {
+func (u *updater) prepareModifyRowUpdate(row, prevRow *monitorRow) (*ovsjson.RowUpdate, string, error) {
 	// the event is modify
 	if !libovsdb.MSIsTrue(u.Select.Modify) {
 		return nil, "", nil
 	}
-	data, uuid, err := u.prepareRow(event.Kv.Value)
+	data, uuid, err := u.prepareRow(row)
 	if err != nil {
 		return nil, "", err
 	}
-	prevData, prevUUID, err := u.prepareRow(event.PrevKv.Value)
+	prevData, prevUUID, err := u.prepareRow(prevRow)
 	if err != nil {
 		return nil, "", err
 	}
@@ -412,11 +694,14 @@ func (u *updater) prepareModifyRowUpdate(event *clientv3.Event) (*ovsjson.RowUpd
 	return nil, "", nil
 }
 
-func (u *updater) prepareCreateRowInitial(value *[]byte) (*ovsjson.RowUpdate, string, error) {
+func (u *updater) prepareCreateRowInitial(row *monitorRow) (*ovsjson.RowUpdate, string, error) {
 	if !libovsdb.MSIsTrue(u.Select.Initial) {
 		return nil, "", nil
 	}
-	data, uuid, err := u.prepareRow(*value)
+	if selected, err := u.isRowSelected(row); err != nil || !selected {
+		return nil, "", err
+	}
+	data, uuid, err := u.prepareRow(row)
 	if err != nil {
 		return nil, "", err
 	}
@@ -429,16 +714,6 @@ func (u *updater) prepareCreateRowInitial(value *[]byte) (*ovsjson.RowUpdate, st
 	return nil, uuid, nil
 }
 
-func (u *updater) deleteUnselectedColumns(data map[string]interface{}) {
-	if len(u.Columns) != 0 {
-		for column := range data {
-			if _, ok := u.Columns[column]; !ok {
-				delete(data, column)
-			}
-		}
-	}
-}
-
 func unmarshalData(data []byte) (map[string]interface{}, error) {
 	obj := map[string]interface{}{}
 	if err := json.Unmarshal(data, &obj); err != nil {
@@ -447,36 +722,41 @@ func unmarshalData(data []byte) (map[string]interface{}, error) {
 	return obj, nil
 }
 
-func getAndDeleteUUID(data map[string]interface{}) (string, error) {
-	uuidInt, ok := data[COL_UUID]
-	if !ok {
-		return "", fmt.Errorf("row doesn't contain %s", COL_UUID)
-	}
-	delete(data, COL_UUID)
-	uuid, ok := uuidInt.([]interface{})
-	if !ok {
-		return "", fmt.Errorf("wrong uuid type %T %v", uuidInt, uuidInt)
-	}
-	// TODO add uuid parsing
-	if len(uuid) != 2 {
-		return "", fmt.Errorf("wrong uuid type %v", uuid)
+// unmarshalStoredRow returns the stored columns of a row. The rows that were stored by older versions contain the _uuid
+// and _version columns, they are removed.
+func unmarshalStoredRow(data []byte) (map[string]interface{}, error) {
+	row, err := unmarshalData(data)
+	if err != nil {
+		return nil, err
 	}
-	uuidStr, ok := uuid[1].(string)
-	if !ok {
-		return "", fmt.Errorf("wrong type %T %v", uuidInt, uuidInt)
+	delete(row, COL_UUID)
+	delete(row, COL_VERSION)
+	return row, nil
+}
+
+// keyUUID returns the uuid of a row, which is the last element of its key
+func keyUUID(key []byte) (string, error) {
+	keyStr := string(key)
+	uuid := keyStr[strings.LastIndex(keyStr, common.KEY_DELIMETER)+1:]
+	if uuid == "" {
+		return "", fmt.Errorf("key %q doesn't contain uuid", keyStr)
 	}
-	return uuidStr, nil
+	return uuid, nil
 }
 
-func (u *updater) prepareRow(value []byte) (map[string]interface{}, string, error) {
-	data, err := unmarshalData(value)
+// prepareRow returns the monitored columns of the row and its uuid, the returned row is a copy that the updater can
+// modify
+func (u *updater) prepareRow(row *monitorRow) (map[string]interface{}, string, error) {
+	data, uuid, err := row.decode()
 	if err != nil {
 		return nil, "", err
 	}
-	uuid, err := getAndDeleteUUID(data)
-	if err != nil {
-		return nil, "", err
+	columns := map[string]interface{}{}
+	for column, value := range data {
+		if len(u.Columns) != 0 && !u.Columns[column] {
+			continue
+		}
+		columns[column] = value
 	}
-	u.deleteUnselectedColumns(data)
-	return data, uuid, nil
+	return columns, uuid, nil
 }
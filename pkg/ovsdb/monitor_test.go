@@ -7,8 +7,8 @@ import (
 	"sync"
 	"testing"
 
-	guuid "github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	klog "k8s.io/klog/v2"
@@ -40,7 +40,6 @@ func TestMonitorRowUpdate(t *testing.T) {
 	}
 
 	data := map[string]interface{}{"c1": "v1", "c2": "v2"}
-	data[COL_UUID] = libovsdb.UUID{GoUUID: guuid.NewString()}
 	data1Json, err := json.Marshal(data)
 	assert.Nilf(t, err, "marshalling %v, threw %v", data, err)
 
@@ -51,88 +50,88 @@ func TestMonitorRowUpdate(t *testing.T) {
 	tests := map[string]struct {
 		updater updater
 		op      operation
-	}{"allColumns-v1": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{}, "", true),
+	}{"allColumns-v1": {updater: testUpdater(ovsjson.MonitorCondRequest{}, true),
 		op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-			Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"),
+			Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID),
 				Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 			expRowUpdate: &ovsjson.RowUpdate{New: &map[string]interface{}{"c1": "v1", "c2": "v2"}}},
 			DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-				PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"),
+				PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID),
 					Value: data1Json},
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/uuid")}},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 				expRowUpdate: &ovsjson.RowUpdate{Old: &map[string]interface{}{"c1": "v1", "c2": "v2"}}},
 			MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-				PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/uuid"),
+				PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID),
 					Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 				expRowUpdate: &ovsjson.RowUpdate{Old: &map[string]interface{}{"c2": "v2"}, New: &map[string]interface{}{"c1": "v1", "c2": "v3"}}}}},
-		"SingleColumn-v1": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c2"}}, "", true),
+		"SingleColumn-v1": {updater: testUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c2"}}, true),
 			op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"),
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID),
 					Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 				expRowUpdate: &ovsjson.RowUpdate{New: &map[string]interface{}{"c2": "v2"}}},
 				DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000")}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 					expRowUpdate: &ovsjson.RowUpdate{Old: &map[string]interface{}{"c2": "v2"}}},
 				MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 					expRowUpdate: &ovsjson.RowUpdate{Old: &map[string]interface{}{"c2": "v2"}, New: &map[string]interface{}{"c2": "v3"}}}}},
-		"ZeroColumn-v1": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c3"}}, "", true),
+		"ZeroColumn-v1": {updater: testUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c3"}}, true),
 			op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 				expRowUpdate: nil},
 				DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000")}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 					expRowUpdate: nil},
 				MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 					expRowUpdate: nil}}},
 
-		"allColumns-v2": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{}, "", false),
+		"allColumns-v2": {updater: testUpdater(ovsjson.MonitorCondRequest{}, false),
 			op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 				expRowUpdate: &ovsjson.RowUpdate{Insert: &map[string]interface{}{"c1": "v1", "c2": "v2"}}},
 				DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000")}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 					expRowUpdate: &ovsjson.RowUpdate{Delete: true}},
 				MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 					expRowUpdate: &ovsjson.RowUpdate{Modify: &map[string]interface{}{"c2": "v3"}}}}},
-		"SingleColumn-v2": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c2"}}, "", false),
+		"SingleColumn-v2": {updater: testUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c2"}}, false),
 			op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 				expRowUpdate: &ovsjson.RowUpdate{Insert: &map[string]interface{}{"c2": "v2"}}},
 				DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000")}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 					expRowUpdate: &ovsjson.RowUpdate{Delete: true}},
 				MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 					expRowUpdate: &ovsjson.RowUpdate{Modify: &map[string]interface{}{"c2": "v3"}}}}},
-		"ZeroColumn-v2": {updater: *mcrToUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c3"}}, "", false),
+		"ZeroColumn-v2": {updater: testUpdater(ovsjson.MonitorCondRequest{Columns: []string{"c3"}}, false),
 			op: operation{PUT: {event: clientv3.Event{Type: mvccpb.PUT,
-				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
+				Kv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json, CreateRevision: 1, ModRevision: 1}},
 				expRowUpdate: nil},
 				DELETE: {event: clientv3.Event{Type: mvccpb.DELETE,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000")}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID)}},
 					expRowUpdate: &ovsjson.RowUpdate{Delete: true}},
 				MODIFY: {event: clientv3.Event{Type: mvccpb.PUT,
-					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data1Json},
-					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+					PrevKv: &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data1Json},
+					Kv:     &mvccpb.KeyValue{Key: []byte("key/db/table/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 					expRowUpdate: nil}}},
 	}
 	for name, ts := range tests {
 		updater := ts.updater
 		for opName, op := range ts.op {
-			row, _, err := updater.prepareRowUpdate(&op.event)
+			row, _, err := updater.prepareRowUpdate(newMonitorEvent(&op.event))
 			if op.err != nil {
 				assert.EqualErrorf(t, err, op.err.Error(), "[%s-%s test] expected error %s, got %v", name, opName, op.err.Error(), err)
 				continue
@@ -156,6 +155,59 @@ func TestMonitorRowUpdate(t *testing.T) {
 	}
 }
 
+func TestMonitorRowUpdateWhere(t *testing.T) {
+	tableSchema, err := testSchemaSimple.LookupTable("table1")
+	assert.Nil(t, err)
+	where := []interface{}{[]interface{}{"key1", FN_EQ, "a"}, []interface{}{"key2", FN_GT, 5}}
+	updater, err := mcrToUpdater(ovsjson.MonitorCondRequest{Where: where}, "", false, tableSchema, klogr.New())
+	assert.Nil(t, err)
+
+	key := []byte("ovsdb/nb/simple/table1/" + ROW_UUID)
+	/* the values are compared after a json round trip */
+	rowA := map[string]interface{}{"key1": "a", "key2": float64(1)}
+	rowA2 := map[string]interface{}{"key1": "a", "key2": float64(2)}
+	rowB := map[string]interface{}{"key1": "b", "key2": float64(1)}
+	kvA := &mvccpb.KeyValue{Key: key, Value: prepareData(t, rowA), CreateRevision: 1, ModRevision: 1}
+	kvA2 := &mvccpb.KeyValue{Key: key, Value: prepareData(t, rowA2), CreateRevision: 1, ModRevision: 2}
+	kvB := &mvccpb.KeyValue{Key: key, Value: prepareData(t, rowB), CreateRevision: 1, ModRevision: 2}
+	modifyA := map[string]interface{}{"key2": float64(2)}
+
+	tests := map[string]struct {
+		event        clientv3.Event
+		expRowUpdate *ovsjson.RowUpdate
+	}{
+		"insert-selected":   {event: clientv3.Event{Type: mvccpb.PUT, Kv: kvA}, expRowUpdate: &ovsjson.RowUpdate{Insert: &rowA}},
+		"insert-unselected": {event: clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: key, Value: kvB.Value, CreateRevision: 1, ModRevision: 1}}},
+		"modify-selected":   {event: clientv3.Event{Type: mvccpb.PUT, PrevKv: kvA, Kv: kvA2}, expRowUpdate: &ovsjson.RowUpdate{Modify: &modifyA}},
+		"modify-into":       {event: clientv3.Event{Type: mvccpb.PUT, PrevKv: kvB, Kv: &mvccpb.KeyValue{Key: key, Value: kvA.Value, CreateRevision: 1, ModRevision: 3}}, expRowUpdate: &ovsjson.RowUpdate{Insert: &rowA}},
+		"modify-out-of":     {event: clientv3.Event{Type: mvccpb.PUT, PrevKv: kvA, Kv: kvB}, expRowUpdate: &ovsjson.RowUpdate{Delete: true}},
+		"delete-selected":   {event: clientv3.Event{Type: mvccpb.DELETE, PrevKv: kvA, Kv: &mvccpb.KeyValue{Key: key}}, expRowUpdate: &ovsjson.RowUpdate{Delete: true}},
+		"delete-unselected": {event: clientv3.Event{Type: mvccpb.DELETE, PrevKv: kvB, Kv: &mvccpb.KeyValue{Key: key}}},
+	}
+	for name, test := range tests {
+		row, _, err := updater.prepareRowUpdate(newMonitorEvent(&test.event))
+		assert.Nilf(t, err, "[%s test] returned unexpected error %v", name, err)
+		assert.Equalf(t, test.expRowUpdate, row, "[%s test] returned wrong row update", name)
+	}
+
+	row, _, err := updater.prepareCreateRowInitial(newMonitorRow(kvB))
+	assert.Nil(t, err)
+	assert.Nil(t, row)
+	row, _, err = updater.prepareCreateRowInitial(newMonitorRow(kvA))
+	assert.Nil(t, err)
+	assert.Equal(t, &ovsjson.RowUpdate{Initial: &rowA}, row)
+
+	/* a true condition selects all the rows */
+	updater, err = mcrToUpdater(ovsjson.MonitorCondRequest{Where: []interface{}{false, true}}, "", false, tableSchema, klogr.New())
+	assert.Nil(t, err)
+	row, _, err = updater.prepareCreateRowInitial(newMonitorRow(kvB))
+	assert.Nil(t, err)
+	assert.Equal(t, &ovsjson.RowUpdate{Initial: &rowB}, row)
+
+	_, err = mcrToUpdater(ovsjson.MonitorCondRequest{Where: []interface{}{[]interface{}{"unknown", FN_EQ, "a"}}}, "", false, tableSchema, klogr.New())
+	assert.NotNil(t, err)
+}
+
 func TestMonitorAddRemoveMonitor(t *testing.T) {
 	db, _ := NewDatabaseMock()
 	ctx := context.Background()
@@ -273,15 +325,14 @@ func TestMonitorNotifications1(t *testing.T) {
 	msg := `["dbName",` + jsonValue + `,{"T1":[{"columns":[]}]}]`
 	handler := initHandler(t, msg, ovsjson.Update)
 	row := map[string]interface{}{"c1": "v1", "c2": "v2"}
-	dataJson := prepareData(t, row, true)
+	dataJson := prepareData(t, row)
 
 	events := []*clientv3.Event{
-		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T1/000"),
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T1/" + ROW_UUID),
 			Value: dataJson, CreateRevision: 1, ModRevision: 1}}}
 
 	tableUpdates := ovsjson.TableUpdates{}
 	tableUpdate := ovsjson.TableUpdate{}
-	delete(row, COL_UUID)
 	rowUpdate := ovsjson.RowUpdate{New: &row}
 	tableUpdate[ROW_UUID] = rowUpdate
 	tableUpdates["T1"] = tableUpdate
@@ -307,12 +358,12 @@ func TestMonitorNotifications2(t *testing.T) {
 	handler := initHandler(t, msg, ovsjson.Update2)
 	jsonValue := []interface{}{"monid", "update2"}
 	row := map[string]interface{}{"c1": "v1", "c2": "v2"}
-	dataJson := prepareData(t, row, true)
+	dataJson := prepareData(t, row)
 
 	events := []*clientv3.Event{
 		{Type: mvccpb.DELETE,
-			PrevKv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T2/000"), Value: dataJson},
-			Kv:     &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T2/000")}},
+			PrevKv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T2/" + ROW_UUID), Value: dataJson},
+			Kv:     &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T2/" + ROW_UUID)}},
 	}
 	tableUpdates := ovsjson.TableUpdates{}
 	tableUpdate := ovsjson.TableUpdate{}
@@ -341,22 +392,21 @@ func TestMonitorNotifications3(t *testing.T) {
 	jsonValue := []interface{}{"monid", "update3"}
 	handler := initHandler(t, msg, ovsjson.Update3)
 	row1 := map[string]interface{}{"c1": "v1", "c2": "v2"}
-	data1Json := prepareData(t, row1, true)
+	data1Json := prepareData(t, row1)
 	row2 := map[string]interface{}{"c2": "v3"}
-	data2Json := prepareData(t, row2, true)
+	data2Json := prepareData(t, row2)
 
 	events := []*clientv3.Event{
 		{Type: mvccpb.PUT,
-			PrevKv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T3/000"), Value: data1Json},
-			Kv:     &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T3/000"), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
+			PrevKv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T3/" + ROW_UUID), Value: data1Json},
+			Kv:     &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T3/" + ROW_UUID), Value: data2Json, CreateRevision: 1, ModRevision: 2}},
 	}
 	tableUpdates := ovsjson.TableUpdates{}
 	tableUpdate := ovsjson.TableUpdate{}
-	delete(row2, COL_UUID)
 	rowUpdate := ovsjson.RowUpdate{Modify: &row2}
 	tableUpdate[ROW_UUID] = rowUpdate
 	tableUpdates["T3"] = tableUpdate
-	expMsg, err := json.Marshal([]interface{}{jsonValue, LAST_TNX, tableUpdates})
+	expMsg, err := json.Marshal([]interface{}{jsonValue, revisionUUID(2), tableUpdates})
 	assert.Nil(t, err)
 
 	jrpcServerMock := jrpcServerMock{
@@ -373,6 +423,122 @@ func TestMonitorNotifications3(t *testing.T) {
 	wg.Wait()
 }
 
+func TestMonitorCondChange(t *testing.T) {
+	msg := `["dbName",["monid","old"],{"T1":[{"columns":["c1"],"where":[false]}]}]`
+	handler := initHandler(t, msg, ovsjson.Update2)
+	oldJsonValue := []interface{}{"monid", "old"}
+	newJsonValue := []interface{}{"monid", "new"}
+	row := map[string]interface{}{"c1": "v1", "c2": "v2"}
+	handler.db.(*DatabaseMock).Response = &clientv3.TxnResponse{
+		Header: &etcdserverpb.ResponseHeader{Revision: 1},
+		Responses: []*etcdserverpb.ResponseOp{{Response: &etcdserverpb.ResponseOp_ResponseRange{
+			ResponseRange: &etcdserverpb.RangeResponse{Kvs: []*mvccpb.KeyValue{{
+				Key: []byte("ovsdb/nb/dbName/T1/" + ROW_UUID), Value: prepareData(t, row), CreateRevision: 1, ModRevision: 1}}}}}},
+	}
+	notifications := handler.handlerMonitorData[jsonValueToString(oldJsonValue)].notifications
+	condChange := func(oldJsonValue, newJsonValue interface{}, where []interface{}) notificationEvent {
+		_, err := handler.MonitorCondChange(context.Background(),
+			[]interface{}{oldJsonValue, newJsonValue, map[string]interface{}{"T1": []interface{}{map[string]interface{}{"where": where}}}})
+		assert.Nil(t, err)
+		event, state := notifications.pop(context.Background())
+		assert.Equal(t, queueOpen, state)
+		return *event
+	}
+
+	// the row enters the monitored rows, with the monitored columns
+	event := condChange(oldJsonValue, newJsonValue, []interface{}{true})
+	assert.Equal(t, newJsonValue, event.jsonValue)
+	assert.Equal(t, ovsjson.TableUpdates{"T1": {ROW_UUID: {Insert: &map[string]interface{}{"c1": "v1"}}}}, event.updates)
+	_, ok := handler.handlerMonitorData[jsonValueToString(oldJsonValue)]
+	assert.False(t, ok)
+	updaters := handler.monitors[DB_NAME].key2Updaters[common.NewTableKey(DB_NAME, "T1")]
+	assert.Equal(t, 1, len(updaters))
+	assert.Equal(t, jsonValueToString(newJsonValue), updaters[0].jasonValueStr)
+	assert.Equal(t, map[string]bool{"c1": true}, updaters[0].Columns)
+
+	// the row leaves the monitored rows
+	event = condChange(newJsonValue, newJsonValue, []interface{}{false})
+	assert.Equal(t, ovsjson.TableUpdates{"T1": {ROW_UUID: {Delete: true}}}, event.updates)
+
+	_, err := handler.MonitorCondChange(context.Background(), []interface{}{oldJsonValue, newJsonValue, map[string]interface{}{}})
+	assert.NotNil(t, err)
+}
+
+func TestMonitorCondSince(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{"key1": "val1", "key2": 1}
+	row2 := map[string]interface{}{"key1": "val2", "key2": 2}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{Op: OP_INSERT, Table: &table, Row: &row1},
+			{Op: OP_INSERT, Table: &table, Row: &row2},
+		},
+	})
+	assert.Nil(t, resp.Error)
+	uuid1 := resp.Result[0].UUID.GoUUID
+	uuid2 := resp.Result[1].UUID.GoUUID
+	_, revision := testRevertRows(t, "simple", table)
+
+	update := map[string]interface{}{"key1": "val3"}
+	row3 := map[string]interface{}{"key1": "val4"}
+	resp, _ = testTransact(t, &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{Op: OP_UPDATE, Table: &table, Row: &update, Where: &[]interface{}{[]interface{}{COL_UUID, FN_EQ, libovsdb.UUID{GoUUID: uuid1}}}},
+			{Op: OP_DELETE, Table: &table, Where: &[]interface{}{[]interface{}{COL_UUID, FN_EQ, libovsdb.UUID{GoUUID: uuid2}}}},
+			{Op: OP_INSERT, Table: &table, Row: &row3},
+		},
+	})
+	assert.Nil(t, resp.Error)
+	uuid3 := resp.Result[2].UUID.GoUUID
+	_, currentRevision := testRevertRows(t, "simple", table)
+
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := NewHandler(ctx, db, cli, klogr.New())
+	monitorCondSince := func(jsonValue string, lastTxnID string) []interface{} {
+		res, err := handler.MonitorCondSince(ctx, []interface{}{"simple", jsonValue,
+			map[string]interface{}{table: []interface{}{map[string]interface{}{"columns": []interface{}{"key1"}}}}, lastTxnID})
+		assert.Nil(t, err)
+		assert.Nil(t, handler.removeMonitor(jsonValue, false))
+		return res.([]interface{})
+	}
+
+	// the changes since the revision
+	res := monitorCondSince("since", revisionUUID(revision))
+	assert.Equal(t, true, res[0])
+	assert.Equal(t, revisionUUID(currentRevision), res[1])
+	assert.Equal(t, ovsjson.TableUpdates{table: {
+		uuid1: {Modify: &map[string]interface{}{"key1": "val3"}},
+		uuid2: {Delete: true},
+		uuid3: {Insert: &map[string]interface{}{"key1": "val4"}},
+	}}, res[2])
+
+	// all the rows of an unknown transaction
+	res = monitorCondSince("unknown", ovsjson.ZERO_UUID)
+	assert.Equal(t, false, res[0])
+	assert.Equal(t, revisionUUID(currentRevision), res[1])
+	assert.Equal(t, ovsjson.TableUpdates{table: {
+		uuid1: {Initial: &map[string]interface{}{"key1": "val3"}},
+		uuid3: {Initial: &map[string]interface{}{"key1": "val4"}},
+	}}, res[2])
+
+	// all the rows of a compacted transaction
+	_, err = cli.Compact(context.Background(), currentRevision)
+	assert.Nil(t, err)
+	res = monitorCondSince("compacted", revisionUUID(revision))
+	assert.Equal(t, false, res[0])
+	assert.Equal(t, 2, len(res[2].(ovsjson.TableUpdates)[table]))
+}
+
 func initHandler(t *testing.T, msg string, notificationType ovsjson.UpdateNotificationType) *Handler {
 	common.SetPrefix("ovsdb/nb")
 	db, _ := NewDatabaseMock()
@@ -390,10 +556,15 @@ func initHandler(t *testing.T, msg string, notificationType ovsjson.UpdateNotifi
 	return handler
 }
 
-func prepareData(t *testing.T, data map[string]interface{}, withUUID bool) []byte {
-	if withUUID {
-		data[COL_UUID] = libovsdb.UUID{GoUUID: ROW_UUID}
+func testUpdater(mcr ovsjson.MonitorCondRequest, isV1 bool) updater {
+	u, err := mcrToUpdater(mcr, "", isV1, nil, klogr.New())
+	if err != nil {
+		panic(err)
 	}
+	return *u
+}
+
+func prepareData(t *testing.T, data map[string]interface{}) []byte {
 	dataJson, err := json.Marshal(data)
 	assert.Nilf(t, err, "marshalling %v, threw %v", data, err)
 	return dataJson
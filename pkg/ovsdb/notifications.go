@@ -0,0 +1,396 @@
+package ovsdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ibm/ovsdb-etcd/pkg/ovsjson"
+)
+
+// The policies of a monitor whose pending notifications exceed the limits of its queue
+const (
+	// the monitor is canceled by a monitor_canceled notification
+	SLOW_CONSUMER_CANCEL = "cancel"
+	// the pending notifications are replaced by a single notification of the changes since the first of them
+	SLOW_CONSUMER_RESYNC = "resync"
+)
+
+// NotificationQueueLength is the maximal number of the pending notifications of a monitor. The notification of a
+// transaction is merged into the last pending notification when it is possible, so the queue is longer than one only
+// if the client doesn't read its notifications, or if a row is deleted and inserted again.
+var NotificationQueueLength = 100
+
+// NotificationQueueRows is the maximal number of the pending row updates of a monitor
+var NotificationQueueRows = 100000
+
+var slowConsumerPolicy = SLOW_CONSUMER_CANCEL
+
+// SetSlowConsumerPolicy sets the policy of the monitors whose pending notifications exceed the limits of their queues
+func SetSlowConsumerPolicy(policy string) error {
+	switch policy {
+	case SLOW_CONSUMER_CANCEL, SLOW_CONSUMER_RESYNC:
+		slowConsumerPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("unknown slow consumer policy %q, expected %q or %q", policy, SLOW_CONSUMER_CANCEL, SLOW_CONSUMER_RESYNC)
+}
+
+type queueState int
+
+const (
+	// the notifications are queued
+	queueOpen queueState = iota
+	// the pending notifications were discarded, the notifier sends the changes since the first of them instead
+	queueResync
+	// the pending notifications were discarded, the notifier cancels the monitor
+	queueCanceled
+	// the monitor was removed
+	queueClosed
+)
+
+// notificationQueue is the bounded queue of the notifications of a monitor of a connection, which are sent by its
+// notifier. The monitor adds the notifications while holding its lock, so adding a notification never waits for the
+// client.
+type notificationQueue struct {
+	// signaled when the queue is changed
+	ready chan struct{}
+
+	mu     sync.Mutex
+	state  queueState
+	events []*notificationEvent
+	// the number of the row updates of the pending notifications
+	rows int
+	// the json-value of the last notification
+	jsonValue interface{}
+	// the discarded notifications in the resync and canceled states, it has the revisions and the wait groups of
+	// all of them
+	discarded *notificationEvent
+}
+
+func newNotificationQueue(jsonValue interface{}) *notificationQueue {
+	return &notificationQueue{ready: make(chan struct{}, 1), jsonValue: jsonValue}
+}
+
+func (q *notificationQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push adds the notification to the queue, it is merged into the last pending notification if it is possible. If the
+// queue exceeds its limits, the slow consumer policy is applied.
+func (q *notificationQueue) push(event *notificationEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jsonValue = event.jsonValue
+	switch q.state {
+	case queueResync:
+		if event.conditionChange {
+			/* the rows that enter the monitor by the new conditions are not changed since the discarded notifications */
+			q.discarded.done()
+			event.done()
+			q.state = queueCanceled
+			q.signal()
+			return
+		}
+		q.discarded.jsonValue = event.jsonValue
+		q.discarded.revision = event.revision
+		q.discarded.wgs = append(q.discarded.wgs, event.wgs...)
+		return
+	case queueCanceled, queueClosed:
+		event.done()
+		return
+	}
+	event.rows = countRowUpdates(event.updates)
+	if n := len(q.events); n > 0 {
+		last := q.events[n-1]
+		rows := last.rows
+		if last.merge(event) {
+			q.rows += last.rows - rows
+			q.checkLimits()
+			return
+		}
+	}
+	q.events = append(q.events, event)
+	q.rows += event.rows
+	q.checkLimits()
+	q.signal()
+}
+
+// checkLimits applies the slow consumer policy if the queue exceeds its limits, the caller holds q.mu
+func (q *notificationQueue) checkLimits() {
+	if len(q.events) <= NotificationQueueLength && q.rows <= NotificationQueueRows {
+		return
+	}
+	q.discard(slowConsumerPolicy)
+}
+
+// discard discards the pending notifications according to the policy, the caller holds q.mu
+func (q *notificationQueue) discard(policy string) {
+	discarded := &notificationEvent{jsonValue: q.jsonValue}
+	for _, event := range q.events {
+		if discarded.firstRevision == 0 {
+			discarded.firstRevision = event.firstRevision
+		}
+		discarded.revision = event.revision
+		discarded.conditionChange = discarded.conditionChange || event.conditionChange
+		discarded.wgs = append(discarded.wgs, event.wgs...)
+	}
+	if policy == SLOW_CONSUMER_RESYNC && discarded.firstRevision > 0 && !discarded.conditionChange {
+		q.state = queueResync
+	} else {
+		discarded.done()
+		q.state = queueCanceled
+	}
+	q.discarded = discarded
+	q.events = nil
+	q.rows = 0
+	q.signal()
+}
+
+// failed is called when the notifier failed to send the notification, the client missed its updates, so the policy
+// is applied to the notification and the pending ones
+func (q *notificationQueue) failed(event *notificationEvent, resync bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state != queueOpen {
+		return
+	}
+	failed := &notificationEvent{jsonValue: event.jsonValue, revision: event.revision, firstRevision: event.firstRevision,
+		conditionChange: event.conditionChange}
+	q.events = append([]*notificationEvent{failed}, q.events...)
+	if resync {
+		/* the resync itself failed */
+		q.discard(SLOW_CONSUMER_CANCEL)
+	} else {
+		q.discard(slowConsumerPolicy)
+	}
+}
+
+// resynced replaces the discarded notifications by the notification of the changes since the first of them. The
+// caller holds the lock of the monitor, so the following notifications are queued after it. It returns false if the
+// queue was canceled or closed in the meantime.
+func (q *notificationQueue) resynced(discarded, event *notificationEvent) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state != queueResync || q.discarded != discarded {
+		return false
+	}
+	event.wgs = discarded.wgs
+	q.discarded = nil
+	q.state = queueOpen
+	return true
+}
+
+// cancel discards the pending notifications, the notifier cancels the monitor
+func (q *notificationQueue) cancel() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state == queueClosed || q.state == queueCanceled {
+		return
+	}
+	if q.state == queueResync {
+		q.discarded.done()
+		q.state = queueCanceled
+		q.signal()
+		return
+	}
+	q.discard(SLOW_CONSUMER_CANCEL)
+}
+
+// close discards the pending notifications of a removed monitor, and stops its notifier
+func (q *notificationQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, event := range q.events {
+		event.done()
+	}
+	if q.state == queueResync {
+		q.discarded.done()
+	}
+	q.events = nil
+	q.rows = 0
+	q.state = queueClosed
+	q.signal()
+}
+
+// pop waits for the next notification to send. In the resync and canceled states it returns the discarded
+// notifications. It returns the closed state when the context is done.
+func (q *notificationQueue) pop(ctx context.Context) (*notificationEvent, queueState) {
+	for {
+		q.mu.Lock()
+		switch q.state {
+		case queueResync, queueCanceled:
+			discarded, state := q.discarded, q.state
+			q.mu.Unlock()
+			return discarded, state
+		case queueClosed:
+			q.mu.Unlock()
+			return nil, queueClosed
+		}
+		if len(q.events) > 0 {
+			event := q.events[0]
+			q.events[0] = nil
+			q.events = q.events[1:]
+			q.rows -= event.rows
+			q.mu.Unlock()
+			return event, queueOpen
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, queueClosed
+		}
+	}
+}
+
+func (e *notificationEvent) done() {
+	for _, wg := range e.wgs {
+		wg.Done()
+	}
+	e.wgs = nil
+}
+
+// merge merges the next notification into the notification, so it has the changes of both. It returns false if the
+// notifications have different json-values, or a row update can't be merged.
+func (e *notificationEvent) merge(next *notificationEvent) bool {
+	if !reflect.DeepEqual(e.jsonValue, next.jsonValue) {
+		return false
+	}
+	merged := map[string]map[string]*ovsjson.RowUpdate{}
+	for table, tableUpdate := range next.updates {
+		for uuid, rowUpdate := range tableUpdate {
+			prevUpdate, ok := e.updates[table][uuid]
+			if !ok {
+				continue
+			}
+			update, ok := mergeRowUpdate(prevUpdate, rowUpdate)
+			if !ok {
+				return false
+			}
+			if merged[table] == nil {
+				merged[table] = map[string]*ovsjson.RowUpdate{}
+			}
+			merged[table][uuid] = update
+		}
+	}
+	for table, tableUpdate := range next.updates {
+		prevTableUpdate, ok := e.updates[table]
+		if !ok {
+			e.updates[table] = tableUpdate
+			continue
+		}
+		for uuid, rowUpdate := range tableUpdate {
+			update, ok := merged[table][uuid]
+			switch {
+			case !ok:
+				prevTableUpdate[uuid] = rowUpdate
+			case update == nil:
+				delete(prevTableUpdate, uuid)
+			default:
+				prevTableUpdate[uuid] = *update
+			}
+		}
+		if len(prevTableUpdate) == 0 {
+			delete(e.updates, table)
+		}
+	}
+	e.revision = next.revision
+	e.conditionChange = e.conditionChange || next.conditionChange
+	e.wgs = append(e.wgs, next.wgs...)
+	e.rows = countRowUpdates(e.updates)
+	return true
+}
+
+// mergeRowUpdate returns the update of a row with the changes of the update followed by the changes of the next one,
+// or nil if the row is not changed, i.e. it was inserted and deleted. It returns false if the updates can't be merged,
+// i.e. a deleted row was inserted again.
+func mergeRowUpdate(update, next ovsjson.RowUpdate) (*ovsjson.RowUpdate, bool) {
+	if update.New != nil || update.Old != nil {
+		return mergeRowUpdateV1(update, next)
+	}
+	switch {
+	case update.Insert != nil || update.Initial != nil:
+		if next.Delete {
+			return nil, true
+		}
+		if next.Modify == nil {
+			return nil, false
+		}
+		merged := update
+		if update.Insert != nil {
+			merged.Insert = overlayColumns(*update.Insert, *next.Modify)
+		} else {
+			merged.Initial = overlayColumns(*update.Initial, *next.Modify)
+		}
+		return &merged, true
+	case update.Modify != nil:
+		if next.Delete {
+			return &ovsjson.RowUpdate{Delete: true}, true
+		}
+		if next.Modify == nil {
+			return nil, false
+		}
+		return &ovsjson.RowUpdate{Modify: overlayColumns(*update.Modify, *next.Modify)}, true
+	}
+	return nil, false
+}
+
+// mergeRowUpdateV1 merges the updates of the update notification, "old" has the previous values of the modified
+// columns, or all the columns of a deleted row
+func mergeRowUpdateV1(update, next ovsjson.RowUpdate) (*ovsjson.RowUpdate, bool) {
+	switch {
+	case update.Old == nil:
+		// the row was inserted
+		if next.Old == nil {
+			return nil, false
+		}
+		if next.New == nil {
+			return nil, true
+		}
+		return &ovsjson.RowUpdate{New: next.New}, true
+	case update.New != nil:
+		// the row was modified, "old" has the values that the client knows
+		if next.Old == nil {
+			return nil, false
+		}
+		old := overlayColumns(*next.Old, *update.Old)
+		if next.New == nil {
+			return &ovsjson.RowUpdate{Old: old}, true
+		}
+		for column, value := range *old {
+			if reflect.DeepEqual(value, (*next.New)[column]) {
+				delete(*old, column)
+			}
+		}
+		if len(*old) == 0 {
+			return nil, true
+		}
+		return &ovsjson.RowUpdate{New: next.New, Old: old}, true
+	}
+	return nil, false
+}
+
+// overlayColumns returns the columns with the values of the next columns
+func overlayColumns(columns, next map[string]interface{}) *map[string]interface{} {
+	merged := map[string]interface{}{}
+	for column, value := range columns {
+		merged[column] = value
+	}
+	for column, value := range next {
+		merged[column] = value
+	}
+	return &merged
+}
+
+func countRowUpdates(updates ovsjson.TableUpdates) int {
+	rows := 0
+	for _, tableUpdate := range updates {
+		rows += len(tableUpdate)
+	}
+	return rows
+}
@@ -0,0 +1,213 @@
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	klogr "k8s.io/klog/v2/klogr"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+	"github.com/ibm/ovsdb-etcd/pkg/ovsjson"
+)
+
+func TestNotificationMergeRowUpdate(t *testing.T) {
+	row := func(columns map[string]interface{}) *map[string]interface{} {
+		return &columns
+	}
+	tests := map[string]struct {
+		update   ovsjson.RowUpdate
+		next     ovsjson.RowUpdate
+		expected *ovsjson.RowUpdate
+		ok       bool
+	}{
+		"insert-modify": {
+			update:   ovsjson.RowUpdate{Insert: row(map[string]interface{}{"c1": "v1", "c2": "v2"})},
+			next:     ovsjson.RowUpdate{Modify: row(map[string]interface{}{"c2": "v3"})},
+			expected: &ovsjson.RowUpdate{Insert: row(map[string]interface{}{"c1": "v1", "c2": "v3"})},
+			ok:       true},
+		"insert-delete": {
+			update: ovsjson.RowUpdate{Insert: row(map[string]interface{}{"c1": "v1"})},
+			next:   ovsjson.RowUpdate{Delete: true},
+			ok:     true},
+		"modify-modify": {
+			update:   ovsjson.RowUpdate{Modify: row(map[string]interface{}{"c1": "v2"})},
+			next:     ovsjson.RowUpdate{Modify: row(map[string]interface{}{"c2": "v3"})},
+			expected: &ovsjson.RowUpdate{Modify: row(map[string]interface{}{"c1": "v2", "c2": "v3"})},
+			ok:       true},
+		"modify-delete": {
+			update:   ovsjson.RowUpdate{Modify: row(map[string]interface{}{"c1": "v2"})},
+			next:     ovsjson.RowUpdate{Delete: true},
+			expected: &ovsjson.RowUpdate{Delete: true},
+			ok:       true},
+		"delete-insert": {
+			update: ovsjson.RowUpdate{Delete: true},
+			next:   ovsjson.RowUpdate{Insert: row(map[string]interface{}{"c1": "v1"})},
+			ok:     false},
+		"v1-insert-modify": {
+			update:   ovsjson.RowUpdate{New: row(map[string]interface{}{"c1": "v1", "c2": "v2"})},
+			next:     ovsjson.RowUpdate{Old: row(map[string]interface{}{"c2": "v2"}), New: row(map[string]interface{}{"c1": "v1", "c2": "v3"})},
+			expected: &ovsjson.RowUpdate{New: row(map[string]interface{}{"c1": "v1", "c2": "v3"})},
+			ok:       true},
+		"v1-insert-delete": {
+			update: ovsjson.RowUpdate{New: row(map[string]interface{}{"c1": "v1"})},
+			next:   ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1"})},
+			ok:     true},
+		"v1-modify-modify": {
+			update:   ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1"}), New: row(map[string]interface{}{"c1": "v2", "c2": "v2"})},
+			next:     ovsjson.RowUpdate{Old: row(map[string]interface{}{"c2": "v2"}), New: row(map[string]interface{}{"c1": "v2", "c2": "v3"})},
+			expected: &ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1", "c2": "v2"}), New: row(map[string]interface{}{"c1": "v2", "c2": "v3"})},
+			ok:       true},
+		"v1-modify-revert": {
+			update: ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1"}), New: row(map[string]interface{}{"c1": "v2"})},
+			next:   ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v2"}), New: row(map[string]interface{}{"c1": "v1"})},
+			ok:     true},
+		"v1-modify-delete": {
+			update:   ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1"}), New: row(map[string]interface{}{"c1": "v2", "c2": "v2"})},
+			next:     ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v2", "c2": "v2"})},
+			expected: &ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1", "c2": "v2"})},
+			ok:       true},
+		"v1-delete-insert": {
+			update: ovsjson.RowUpdate{Old: row(map[string]interface{}{"c1": "v1"})},
+			next:   ovsjson.RowUpdate{New: row(map[string]interface{}{"c1": "v1"})},
+			ok:     false},
+	}
+	for name, test := range tests {
+		merged, ok := mergeRowUpdate(test.update, test.next)
+		assert.Equal(t, test.ok, ok, name)
+		assert.Equal(t, test.expected, merged, name)
+	}
+}
+
+func TestNotificationQueueMerge(t *testing.T) {
+	q := newNotificationQueue("monid")
+	var wg sync.WaitGroup
+	wg.Add(2)
+	q.push(&notificationEvent{jsonValue: "monid", revision: 2, firstRevision: 2, wgs: []*sync.WaitGroup{&wg},
+		updates: ovsjson.TableUpdates{"T1": {"uuid1": {Insert: &map[string]interface{}{"c1": "v1"}}}}})
+	q.push(&notificationEvent{jsonValue: "monid", revision: 3, firstRevision: 3, wgs: []*sync.WaitGroup{&wg},
+		updates: ovsjson.TableUpdates{"T1": {
+			"uuid1": {Modify: &map[string]interface{}{"c1": "v2"}},
+			"uuid2": {Insert: &map[string]interface{}{"c1": "v3"}}}}})
+
+	/* the updates of both transactions are merged */
+	event, state := q.pop(context.Background())
+	assert.Equal(t, queueOpen, state)
+	assert.Equal(t, int64(2), event.firstRevision)
+	assert.Equal(t, int64(3), event.revision)
+	assert.Equal(t, 2, event.rows)
+	assert.Equal(t, ovsjson.TableUpdates{"T1": {
+		"uuid1": {Insert: &map[string]interface{}{"c1": "v2"}},
+		"uuid2": {Insert: &map[string]interface{}{"c1": "v3"}}}}, event.updates)
+	event.done()
+	wg.Wait()
+
+	/* a deleted row that is inserted again is not merged */
+	q.push(&notificationEvent{jsonValue: "monid", revision: 4, firstRevision: 4,
+		updates: ovsjson.TableUpdates{"T1": {"uuid1": {Delete: true}}}})
+	q.push(&notificationEvent{jsonValue: "monid", revision: 5, firstRevision: 5,
+		updates: ovsjson.TableUpdates{"T1": {"uuid1": {Insert: &map[string]interface{}{"c1": "v4"}}}}})
+	assert.Equal(t, 2, len(q.events))
+	assert.Equal(t, 2, q.rows)
+}
+
+func TestNotificationQueueCancel(t *testing.T) {
+	defer func(rows int) { NotificationQueueRows = rows }(NotificationQueueRows)
+	NotificationQueueRows = 1
+	msg := `["dbName", ["monid","update2"],{"T2":[{"columns":[]}]}]`
+	handler := initHandler(t, msg, ovsjson.Update2)
+	jsonValue := []interface{}{"monid", "update2"}
+	expMsg, err := json.Marshal(jsonValue)
+	assert.Nil(t, err)
+	handler.SetConnection(&jrpcServerMock{expMethod: MONITOR_CANCELED, expMessage: expMsg, t: t}, nil)
+
+	/* the client doesn't read the notifications, the transactions don't wait for it */
+	monitor := handler.monitors[DB_NAME]
+	var wg sync.WaitGroup
+	for i, uuid := range []string{"uuid1", "uuid2"} {
+		events := []*clientv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("ovsdb/nb/dbName/T2/" + uuid),
+			Value: prepareData(t, map[string]interface{}{"c1": "v1"}), CreateRevision: int64(i + 1), ModRevision: int64(i + 1)}}}
+		wg.Add(1)
+		monitor.notify(events, int64(i+1), &wg)
+	}
+	wg.Wait()
+
+	/* the notifier cancels the monitor */
+	handler.startNotifier(jsonValueToString(jsonValue))
+	removed := false
+	for i := 0; i < 50 && !removed; i++ {
+		time.Sleep(100 * time.Millisecond)
+		handler.mu.Lock()
+		_, ok := handler.handlerMonitorData[jsonValueToString(jsonValue)]
+		handler.mu.Unlock()
+		removed = !ok
+	}
+	assert.True(t, removed)
+}
+
+func TestNotificationQueueResync(t *testing.T) {
+	defer func(rows int, policy string) {
+		NotificationQueueRows = rows
+		slowConsumerPolicy = policy
+	}(NotificationQueueRows, slowConsumerPolicy)
+	NotificationQueueRows = 1
+	assert.Nil(t, SetSlowConsumerPolicy(SLOW_CONSUMER_RESYNC))
+	assert.NotNil(t, SetSlowConsumerPolicy("unknown"))
+
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := NewHandler(ctx, db, cli, klogr.New())
+	params := []interface{}{"simple", "monid", map[string]interface{}{table: []interface{}{map[string]interface{}{"columns": []interface{}{"key1"}}}}}
+	updatersMap, err := handler.addMonitor(params, ovsjson.Update2)
+	assert.Nil(t, err)
+	_, err = handler.getMonitoredData("simple", updatersMap)
+	assert.Nil(t, err)
+	defer handler.removeMonitor("monid", false)
+
+	/* the events are passed to the monitor by the transactions, as the transactions of the connection do */
+	monitor := handler.monitors["simple"]
+	uuids := []string{}
+	revisions := []int64{}
+	for _, value := range []string{"val1", "val2"} {
+		row := map[string]interface{}{"key1": value, "key2": 1}
+		txn := testNewTransaction(cli, &libovsdb.Transact{
+			DBName:     "simple",
+			Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+		})
+		revision, err := txn.Commit()
+		assert.Nil(t, err)
+		uuids = append(uuids, txn.response.Result[0].UUID.GoUUID)
+		revisions = append(revisions, revision)
+		etcdEventsSetRevision(txn.etcd.Events, revision)
+		monitor.notify(txn.etcd.Events, revision, nil)
+	}
+
+	/* the pending notifications are replaced by the changes since the first of them */
+	queue := handler.handlerMonitorData["monid"].notifications
+	discarded, state := queue.pop(ctx)
+	assert.Equal(t, queueResync, state)
+	assert.Equal(t, revisions[0], discarded.firstRevision)
+	event, err := handler.resyncNotification("simple", queue, discarded)
+	assert.Nil(t, err)
+	assert.Equal(t, ovsjson.TableUpdates{table: {
+		uuids[0]: {Insert: &map[string]interface{}{"key1": "val1"}},
+		uuids[1]: {Insert: &map[string]interface{}{"key1": "val2"}}}}, event.updates)
+	assert.Equal(t, monitor.revChecker.getRevision(), event.revision)
+	queue.mu.Lock()
+	assert.Equal(t, queueOpen, queue.state)
+	queue.mu.Unlock()
+}
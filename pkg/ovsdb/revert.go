@@ -0,0 +1,180 @@
+package ovsdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// RevertOperations returns the operations of a transaction that reverts the tables of the database to their rows at
+// the revision: the rows that were inserted after the revision are deleted, the deleted rows are inserted again with
+// their uuids, and the modified rows are updated to their values at the revision. All the tables of the database are
+// reverted if no table is specified.
+//
+// Every deleted or updated row is preceded by a wait operation on its current _version, so the transaction fails
+// if the row is modified after the operations were computed.
+func RevertOperations(ctx context.Context, cli *clientv3.Client, dbSchema *libovsdb.DatabaseSchema, revision int64, tables ...string) ([]libovsdb.Operation, error) {
+	if revision <= 0 {
+		return nil, fmt.Errorf("wrong revision %d", revision)
+	}
+	if len(tables) == 0 {
+		for table := range dbSchema.Tables {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	ops := []clientv3.Op{}
+	for _, table := range tables {
+		if _, ok := dbSchema.Tables[table]; !ok {
+			return nil, fmt.Errorf("unknown table %q", table)
+		}
+		tableKey := common.NewTableKey(dbSchema.Name, table)
+		ops = append(ops, clientv3.OpGet(tableKey.TableKeyString(), clientv3.WithPrefix()))
+	}
+	res, err := cli.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if revision > res.Header.Revision {
+		return nil, fmt.Errorf("revision %d is greater than the current revision %d", revision, res.Header.Revision)
+	}
+	operations := []libovsdb.Operation{}
+	for i, table := range tables {
+		tableKey := common.NewTableKey(dbSchema.Name, table)
+		prevRes, err := cli.Get(ctx, tableKey.TableKeyString(), clientv3.WithPrefix(), clientv3.WithRev(revision))
+		if err == rpctypes.ErrCompacted {
+			return nil, fmt.Errorf("%s: revision %d", E_COMPACTED, revision)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tableSchema := dbSchema.Tables[table]
+		tableOps, err := revertTable(&tableSchema, table, res.Responses[i].GetResponseRange().Kvs, prevRes.Kvs)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, tableOps...)
+	}
+	return operations, nil
+}
+
+// revertTable returns the operations that revert the current rows of the table to the previous ones
+func revertTable(tableSchema *libovsdb.TableSchema, table string, kvs, prevKvs []*mvccpb.KeyValue) ([]libovsdb.Operation, error) {
+	current := map[string]*mvccpb.KeyValue{}
+	previous := map[string]*mvccpb.KeyValue{}
+	uuids := []string{}
+	for _, kv := range kvs {
+		uuid, err := keyUUID(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		current[uuid] = kv
+		uuids = append(uuids, uuid)
+	}
+	for _, kv := range prevKvs {
+		uuid, err := keyUUID(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		previous[uuid] = kv
+		if _, ok := current[uuid]; !ok {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+	operations := []libovsdb.Operation{}
+	for _, uuid := range uuids {
+		kv, prevKv := current[uuid], previous[uuid]
+		switch {
+		case prevKv == nil:
+			operations = append(operations, revertWait(table, uuid, kv.ModRevision),
+				libovsdb.Operation{Op: OP_DELETE, Table: &table, Where: revertWhere(uuid)})
+		case kv == nil:
+			row, err := unmarshalStoredRow(prevKv.Value)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, libovsdb.Operation{Op: OP_INSERT, Table: &table, Row: &row,
+				UUID: &libovsdb.UUID{GoUUID: uuid}})
+		case kv.ModRevision != prevKv.ModRevision:
+			rowOps, err := revertModifiedRow(tableSchema, table, uuid, kv, prevKv)
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, rowOps...)
+		}
+	}
+	return operations, nil
+}
+
+// revertModifiedRow returns the operations that update the columns of the row to their previous values. The update
+// operation merges the values of the map columns, so the pairs of the modified maps are deleted first.
+func revertModifiedRow(tableSchema *libovsdb.TableSchema, table, uuid string, kv, prevKv *mvccpb.KeyValue) ([]libovsdb.Operation, error) {
+	row, err := unmarshalStoredRow(kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	prevRow, err := unmarshalStoredRow(prevKv.Value)
+	if err != nil {
+		return nil, err
+	}
+	nativeRow, err := validatorRow(tableSchema, kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	prevNativeRow, err := validatorRow(tableSchema, prevKv.Value)
+	if err != nil {
+		return nil, err
+	}
+	update := map[string]interface{}{}
+	mutations := []interface{}{}
+	for column, columnSchema := range tableSchema.Columns {
+		value, prevValue := nativeRow[column], prevNativeRow[column]
+		if isEqualValue(value, prevValue) || (value != nil && prevValue != nil &&
+			isEqualColumn(columnSchema, value, prevValue) && isEqualColumn(columnSchema, prevValue, value)) {
+			continue
+		}
+		if columnSchema.Mutable != nil && !*columnSchema.Mutable {
+			return nil, fmt.Errorf("immutable column %q of row %s was modified", column, uuid)
+		}
+		if prevRow[column] == nil {
+			prevRow[column] = columnSchema.Default()
+		}
+		update[column] = prevRow[column]
+		if columnSchema.Type == libovsdb.TypeMap && row[column] != nil {
+			mutations = append(mutations, []interface{}{column, MT_DELETE, row[column]})
+		}
+	}
+	if len(update) == 0 {
+		return nil, nil
+	}
+	operations := []libovsdb.Operation{revertWait(table, uuid, kv.ModRevision)}
+	if len(mutations) > 0 {
+		operations = append(operations, libovsdb.Operation{Op: OP_MUTATE, Table: &table, Where: revertWhere(uuid),
+			Mutations: &mutations})
+	}
+	operations = append(operations, libovsdb.Operation{Op: OP_UPDATE, Table: &table, Where: revertWhere(uuid),
+		Row: &update})
+	return operations, nil
+}
+
+// revertWait returns a wait operation that fails unless the row has the version of the revision
+func revertWait(table, uuid string, revision int64) libovsdb.Operation {
+	timeout := 0
+	until := FN_EQ
+	version := map[string]interface{}{}
+	setRowVersion(&version, revision)
+	return libovsdb.Operation{Op: OP_WAIT, Table: &table, Where: revertWhere(uuid), Columns: &[]string{COL_VERSION},
+		Until: &until, Rows: &[]map[string]interface{}{version}, Timeout: &timeout}
+}
+
+func revertWhere(uuid string) *[]interface{} {
+	return &[]interface{}{[]interface{}{COL_UUID, FN_EQ, libovsdb.UUID{GoUUID: uuid}}}
+}
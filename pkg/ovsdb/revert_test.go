@@ -0,0 +1,165 @@
+package ovsdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// testRevertRows returns the rows of the table by their uuids, and the current revision
+func testRevertRows(t *testing.T, dbname, table string) (map[string]map[string]interface{}, int64) {
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	key := common.NewTableKey(dbname, table)
+	res, err := cli.Get(context.TODO(), key.TableKeyString(), clientv3.WithPrefix())
+	assert.Nil(t, err)
+	rows := map[string]map[string]interface{}{}
+	for _, kv := range res.Kvs {
+		uuid, err := keyUUID(kv.Key)
+		assert.Nil(t, err)
+		rows[uuid], err = unmarshalData(kv.Value)
+		assert.Nil(t, err)
+	}
+	return rows, res.Header.Revision
+}
+
+// testRevert commits the operations that revert the database to the revision, as the revert method does
+func testRevert(t *testing.T, dbSchema *libovsdb.DatabaseSchema, operations []libovsdb.Operation) *libovsdb.TransactResponse {
+	params := []interface{}{dbSchema.Name}
+	for _, op := range operations {
+		params = append(params, op)
+	}
+	req, err := libovsdb.NewTransact(params)
+	assert.Nil(t, err)
+	resp, _ := testTransact(t, req)
+	return resp
+}
+
+func testRevertOperations(t *testing.T, dbSchema *libovsdb.DatabaseSchema, revision int64) []libovsdb.Operation {
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	operations, err := RevertOperations(context.Background(), cli, dbSchema, revision)
+	assert.Nil(t, err)
+	return operations
+}
+
+func TestRevertDatabase(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{"key1": "val1", "key2": 1}
+	row2 := map[string]interface{}{"key1": "val2", "key2": 2}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{Op: OP_INSERT, Table: &table, Row: &row1},
+			{Op: OP_INSERT, Table: &table, Row: &row2},
+		},
+	})
+	assert.Nil(t, resp.Error)
+	uuid1 := resp.Result[0].UUID.GoUUID
+	uuid2 := resp.Result[1].UUID.GoUUID
+	rows, revision := testRevertRows(t, "simple", table)
+
+	update := map[string]interface{}{"key1": "val3"}
+	row3 := map[string]interface{}{"key1": "val4"}
+	resp, _ = testTransact(t, &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{Op: OP_UPDATE, Table: &table, Row: &update, Where: &[]interface{}{[]interface{}{COL_UUID, FN_EQ, libovsdb.UUID{GoUUID: uuid1}}}},
+			{Op: OP_DELETE, Table: &table, Where: &[]interface{}{[]interface{}{COL_UUID, FN_EQ, libovsdb.UUID{GoUUID: uuid2}}}},
+			{Op: OP_INSERT, Table: &table, Row: &row3},
+		},
+	})
+	assert.Nil(t, resp.Error)
+
+	operations := testRevertOperations(t, testSchemaSimple, revision)
+	resp = testRevert(t, testSchemaSimple, operations)
+	assert.Nil(t, resp.Error)
+	revertedRows, _ := testRevertRows(t, "simple", table)
+	assert.Equal(t, rows, revertedRows)
+	assert.Equal(t, 0, len(testRevertOperations(t, testSchemaSimple, revision)))
+}
+
+func TestRevertMap(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{"string": libovsdb.OvsMap{GoMap: map[interface{}]interface{}{"a": "1", "b": "2"}}}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName:     "map",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	})
+	assert.Nil(t, resp.Error)
+	_, revision := testRevertRows(t, "map", table)
+
+	mutations := []interface{}{
+		[]interface{}{"string", MT_DELETE, libovsdb.OvsSet{GoSet: []interface{}{"a"}}},
+		[]interface{}{"string", MT_INSERT, libovsdb.OvsMap{GoMap: map[interface{}]interface{}{"c": "3"}}},
+	}
+	resp, _ = testTransact(t, &libovsdb.Transact{
+		DBName:     "map",
+		Operations: []libovsdb.Operation{{Op: OP_MUTATE, Table: &table, Mutations: &mutations, Where: &[]interface{}{}}},
+	})
+	assert.Nil(t, resp.Error)
+
+	operations := testRevertOperations(t, testSchemaMap, revision)
+	resp = testRevert(t, testSchemaMap, operations)
+	assert.Nil(t, resp.Error)
+	dump := testEtcdDump(t, "map", table)
+	value, ok := dump["string"].([]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(value))
+	assert.ElementsMatch(t, []interface{}{[]interface{}{"a", "1"}, []interface{}{"b", "2"}}, value[1])
+}
+
+func TestRevertConflict(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{"key1": "val1"}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName:     "simple",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	})
+	assert.Nil(t, resp.Error)
+	_, revision := testRevertRows(t, "simple", table)
+
+	update := map[string]interface{}{"key1": "val2"}
+	updateReq := &libovsdb.Transact{
+		DBName:     "simple",
+		Operations: []libovsdb.Operation{{Op: OP_UPDATE, Table: &table, Row: &update, Where: &[]interface{}{}}},
+	}
+	resp, _ = testTransact(t, updateReq)
+	assert.Nil(t, resp.Error)
+	operations := testRevertOperations(t, testSchemaSimple, revision)
+
+	/* the row is modified after the operations were computed */
+	update["key1"] = "val3"
+	resp, _ = testTransact(t, updateReq)
+	assert.Nil(t, resp.Error)
+	resp = testRevert(t, testSchemaSimple, operations)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, "val3", testEtcdDump(t, "simple", table)["key1"])
+}
+
+func TestRevertCompactedError(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	res, err := cli.Get(context.Background(), "ovsdb", clientv3.WithCountOnly())
+	assert.Nil(t, err)
+	_, err = cli.Compact(context.Background(), res.Header.Revision)
+	assert.Nil(t, err)
+	_, err = RevertOperations(context.Background(), cli, testSchemaSimple, res.Header.Revision-1)
+	assert.NotNil(t, err)
+}
@@ -2,6 +2,7 @@ package ovsdb
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/ibm/ovsdb-etcd/pkg/common"
@@ -51,6 +52,38 @@ type Servicer interface {
 	// "result" array corresponds to the same element of the "params" array.
 	Transact(ctx context.Context, param []interface{}) (interface{}, error)
 
+	// ovsdb-etcd extension
+	// The "transact_dry_run" method executes a transaction like "transact", but doesn't commit it to the database.
+	// "params": [<db-name>, <operation>*]
+	// The response object contains the following members:
+	//   	"result": {"results": [<object>*], "changes": <table-updates>}
+	//   	"error": null
+	//   	"id": same "id" as request
+	// "results" are the results that "transact" would return, and "changes" are the rows that would be written, where
+	// "old" and "new" are the complete values of a row before and after the transaction.
+	TransactDryRun(ctx context.Context, param []interface{}) (interface{}, error)
+
+	// ovsdb-etcd extension
+	// The "row_history" method returns the versions of a row that are kept by etcd, i.e. since its last compaction.
+	// "params": [<db-name>, <table>, <uuid>]
+	// The response object contains the following members:
+	//   	"result": {"revision": <integer>, "compact_revision": <integer>, "versions": [<row-version>*]}
+	//   	"error": null
+	//   	"id": same "id" as request
+	// Each <row-version> has the "revision", the "change" ("insert", "modify" or "delete"), the "timestamp" and the
+	// "comments" of the transaction, the "row" (except for "delete"), and the "diff" of the modified columns in the
+	// format of <row-update2>.
+	RowHistory(ctx context.Context, param []interface{}) (interface{}, error)
+
+	// ovsdb-etcd extension
+	// The "revert" method reverts the tables of a database to their rows at an etcd revision, by a transaction that
+	// inverts the changes that were committed after the revision.
+	// "params": [<db-name>, <revision>, <table>*]
+	// All the tables of the database are reverted if no table is specified. The response is the response of the
+	// "transact" method, the transaction deletes the rows that were inserted after the revision, inserts the deleted
+	// rows with their uuids, and updates the modified rows. It fails if any of these rows is modified concurrently.
+	Revert(ctx context.Context, param []interface{}) (interface{}, error)
+
 	// RFC 7047 section 4.1.4
 	// The "cancel" method is a JSON-RPC notification, i.e., no matching response is provided.
 	//	It instructs the database server to  immediately complete or cancel the "transact" request whose "id" is
@@ -172,6 +205,8 @@ type Servicer interface {
 	//  <table-updates2> of this response, so that client can keep tracking. If there is no change involved in this
 	// response, it is the same as the <last-txn-id> in the request if <found> is true, or zero uuid if <found> is false.
 	// If the server does not support transaction uuid, it will be zero uuid as well.
+	// The transaction ids of this server are the uuids of the etcd revisions of the transactions (see revisionUUID), the
+	// returned <last-txn-id> is the revision of the data, and <found> is false if the revision was compacted.
 	MonitorCondSince(ctx context.Context, param ovsjson.CondMonitorParameters) (interface{}, error)
 
 	// ovsdb-server.7 section 4.1.17
@@ -217,17 +252,19 @@ type Service struct {
 
 func (s *Service) ListDbs(ctx context.Context, param interface{}) ([]string, error) {
 	klog.V(5).Info("ListDbs request")
-	resp, err := s.db.GetKeyData(common.NewTableKey(INT_SERVER, INT_DATABASES), true)
+	resp, err := s.db.GetKeyData(common.NewTableKey(INT_SERVER, INT_DATABASES), false)
 	if err != nil {
 		return nil, err
 	}
 	dbs := []string{}
 	for _, kv := range resp.Kvs {
-		key, err := common.ParseKey(string(kv.Key))
-		if err != nil {
+		database := struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(kv.Value, &database); err != nil {
 			return nil, err
 		}
-		dbs = append(dbs, key.UUID)
+		dbs = append(dbs, database.Name)
 	}
 	klog.V(5).Infof("ListDbs returned %v", dbs)
 	return dbs, nil
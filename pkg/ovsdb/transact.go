@@ -6,16 +6,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/jinzhu/copier"
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/ibm/ovsdb-etcd/pkg/common"
@@ -24,6 +25,15 @@ import (
 
 const ETCD_MAX_TXN_OPS = 128
 
+// the maximal number of comparisons of the fetched rows, the rest of ETCD_MAX_TXN_OPS is left for nesting the operations
+const ETCD_MAX_READ_CMPS = ETCD_MAX_TXN_OPS / 2
+
+// the number of times a transaction is re-executed when it conflicts with concurrent transactions
+const TXN_MAX_RETRIES = 16
+
+// the time a durable commit waits for the confirmation of its durability, after the transaction was committed
+const DURABLE_CONFIRM_TIMEOUT = 5 * time.Second
+
 const (
 	/* ovsdb operations */
 	E_DUP_UUIDNAME         = "duplicate uuid-name"
@@ -39,6 +49,7 @@ const (
 	E_INTEGRITY_VIOLATION = "referential integrity violation"
 	E_RESOURCES_EXHAUSTED = "resources exhausted"
 	E_IO_ERROR            = "I/O error"
+	E_CANCELED            = "canceled"
 
 	/* ovsdb extention */
 	E_DUP_UUID         = "duplicate uuid"
@@ -46,8 +57,40 @@ const (
 	E_OVSDB_ERROR      = "ovsdb error"
 	E_PERMISSION_ERROR = "permission error"
 	E_SYNTAX_ERROR     = "syntax error or unknown column"
+	E_COMPACTED        = "revision compacted"
 )
 
+// ovsdbError is an error that carries, in addition to the RFC 7047 error string, a human readable details message
+// that is reported back to the client in the "details" member of the failed operation result.
+type ovsdbError struct {
+	err     string
+	details string
+}
+
+func newOvsdbError(err string, format string, args ...interface{}) error {
+	return &ovsdbError{err: err, details: fmt.Sprintf(format, args...)}
+}
+
+func (e *ovsdbError) Error() string {
+	return e.err
+}
+
+// validationError maps a failure of a row validation against the schema to a "constraint violation" error, its details
+// name the table, the column and the offending value.
+func validationError(err error) error {
+	if vErr, ok := err.(*libovsdb.ValidationError); ok {
+		return newOvsdbError(E_CONSTRAINT_VIOLATION, "%s", vErr.Details())
+	}
+	return newOvsdbError(E_CONSTRAINT_VIOLATION, "%s", err.Error())
+}
+
+func errorDetails(err error) string {
+	if e, ok := err.(*ovsdbError); ok {
+		return e.details
+	}
+	return ""
+}
+
 func isEqualSet(expected, actual interface{}) bool {
 	expectedSet := expected.(libovsdb.OvsSet)
 	actualSet := actual.(libovsdb.OvsSet)
@@ -142,8 +185,26 @@ func isEqualColumn(columnSchema *libovsdb.ColumnSchema, expected, actual interfa
 	}
 }
 
+func isEqualUUID(expected, actual interface{}) bool {
+	expectedUUID, err := libovsdb.UnmarshalUUID(expected)
+	if err != nil {
+		return false
+	}
+	actualUUID, err := libovsdb.UnmarshalUUID(actual)
+	if err != nil {
+		return false
+	}
+	return expectedUUID.(libovsdb.UUID).GoUUID == actualUUID.(libovsdb.UUID).GoUUID
+}
+
 func isEqualRow(txn *Transaction, tableSchema *libovsdb.TableSchema, expectedRow, actualRow *map[string]interface{}) (bool, error) {
 	for column, expected := range *expectedRow {
+		if column == COL_UUID || column == COL_VERSION {
+			if !isEqualUUID(expected, (*actualRow)[column]) {
+				return false, nil
+			}
+			continue
+		}
 		columnSchema, err := tableSchema.LookupColumn(column)
 		if err != nil {
 			err := errors.New(E_CONSTRAINT_VIOLATION)
@@ -224,10 +285,8 @@ func etcdEventKey(ev *clientv3.Event) string {
 }
 
 func (txn *Transaction) etcdRemoveDupEvents() {
-	prevEvents := []*clientv3.Event{}
 	newEvents := []*clientv3.Event{}
 	for i, curr := range txn.etcd.Events {
-		prevEvents = append(prevEvents, txn.etcd.Events[i])
 		newEvents = append(newEvents, txn.etcd.Events[i])
 		if curr == nil {
 			txn.etcd.EventsNilCount++
@@ -245,10 +304,20 @@ func (txn *Transaction) etcdRemoveDupEvents() {
 		key := etcdEventKey(curr)
 		prevIndex, ok := prevKeyIndex[key]
 		if ok {
-			prev := prevEvents[prevIndex]
+			/* the previous event may already be merged with earlier ones */
+			prev := newEvents[prevIndex]
 			if etcdEventIsModify(curr) && etcdEventIsCreate(prev) {
 				newEvents[i] = etcdEventCreateFromModify(curr)
 			}
+			if curr.Type == mvccpb.DELETE && etcdEventIsCreate(prev) {
+				/* the row was created and deleted by the same transaction, the monitors should not be notified */
+				txn.log.V(6).Info("[event] removing created and deleted key", "key", key, "index", i)
+				newEvents[i] = nil
+				txn.etcd.EventsNilCount++
+				delete(prevKeyIndex, key)
+				newEvents[prevIndex] = nil
+				continue
+			}
 			txn.log.V(6).Info("[event] removing key", "key", key, "index", prevIndex)
 			newEvents[prevIndex] = nil
 		}
@@ -273,36 +342,54 @@ func (txn *Transaction) etcdRemoveDup() {
 func (txn *Transaction) etcdTranaction() (*clientv3.TxnResponse, error) {
 	txn.log.V(6).Info("etcd transaction", "etcd", txn.etcd.String())
 
-	// etcds := txn.etcd.Split() // split
-	etcds := []*Etcd{txn.etcd} // don't split
-
-	for i, child := range etcds {
-		txn.log.V(6).Info("etcd processing", "index", i, "child", child.String())
-		errInternal := child.Commit()
-		if errInternal != nil {
-			err := errors.New(E_IO_ERROR)
-			txn.log.Error(err, "etcd processing", "err", errInternal)
-			return nil, err
-		}
-		txn.cache.GetFromEtcd(child.Res)
+	errInternal := txn.etcd.Commit()
+	if errInternal != nil && txn.etcd.Ctx.Err() != nil {
+		err := errors.New(E_CANCELED)
+		txn.log.Error(err, "etcd processing", "err", errInternal)
+		return nil, err
+	}
+	if errInternal != nil {
+		err := errors.New(E_IO_ERROR)
+		txn.log.Error(err, "etcd processing", "err", errInternal)
+		return nil, err
 	}
+	txn.cache.GetFromEtcd(txn.etcd.Res)
+	txn.keepEtcdValues(txn.etcd.Res)
 
 	err := txn.cache.Unmarshal(txn, txn.schemas)
 	if err != nil {
 		txn.log.Error(err, "cache unmarshal")
-		return nil, err
+		return nil, validationError(err)
 	}
 
 	err = txn.cache.Validate(txn, txn.schemas)
 	if err != nil {
-		xErr := errors.New(E_CONSTRAINT_VIOLATION)
 		txn.log.Error(err, "cache validate")
-		return nil, xErr
+		return nil, validationError(err)
 	}
 
 	return txn.etcd.Res, nil
 }
 
+// keepEtcdValues keeps the fetched values, they are the previous values of the events of the modified and deleted rows
+func (txn *Transaction) keepEtcdValues(res *clientv3.TxnResponse) {
+	for _, r := range res.Responses {
+		if v, ok := r.Response.(*etcdserverpb.ResponseOp_ResponseRange); ok {
+			for _, kv := range v.ResponseRange.Kvs {
+				txn.etcdValues[string(kv.Key)] = string(kv.Value)
+			}
+		}
+	}
+}
+
+// etcdPrevValue returns the value of the row before the transaction
+func (txn *Transaction) etcdPrevValue(k *common.Key) (string, error) {
+	if val, ok := txn.etcdValues[k.String()]; ok {
+		return val, nil
+	}
+	return makeValue(txn.cache.Row(*k))
+}
+
 // XXX: move to db
 type KeyValue struct {
 	Key   common.Key
@@ -372,6 +459,8 @@ func (c *Cache) GetFromEtcdKV(kvs []*mvccpb.KeyValue) error {
 		}
 		row := c.Row(kv.Key)
 		(*row) = kv.Value
+		setRowUUID(row, kv.Key.UUID)
+		setRowVersion(row, x.ModRevision)
 	}
 	return nil
 }
@@ -541,40 +630,87 @@ func (etcd Etcd) String() string {
 	return fmt.Sprintf("#then %d, #events %d, #events-nil %d", len(etcd.Then), len(etcd.Events), etcd.EventsNilCount)
 }
 
+// Commit executes the etcd transaction. etcd limits the number of comparisons and operations of a transaction (by
+// --max-txn-ops), the nested transactions share the limit with their parent: they are limited by the remaining of the
+// limit. So oversized transactions are executed as a single etcd transaction with a tree of nested transactions,
+// which is atomic and creates a single revision. The response is flattened, as if the transaction was not nested.
 func (etcd *Etcd) Commit() error {
-	res, err := etcd.Cli.Txn(etcd.Ctx).If(etcd.If...).Then(etcd.Then...).Else(etcd.Else...).Commit()
+	width := len(etcd.If)
+	if width < len(etcd.Else) {
+		width = len(etcd.Else)
+	}
+	then := nestOps(etcd.Then, width, ETCD_MAX_TXN_OPS)
+	res, err := etcd.Cli.Txn(etcd.Ctx).If(etcd.If...).Then(then...).Else(etcd.Else...).Commit()
 	if err != nil {
 		return err
 	}
+	if res.Succeeded && len(then) != len(etcd.Then) {
+		res = &clientv3.TxnResponse{Header: res.Header, Succeeded: true, Responses: unnestOps(res.Responses)}
+	}
 	etcd.Res = res
 	return nil
 }
 
-func (etcd *Etcd) Split() []*Etcd {
-	split := []*Etcd{}
-	child := NewEtcd(etcd)
-	split = append(split, child)
-	for _, op := range etcd.Then {
-		child.Then = append(child.Then, op)
-		if len(child.Then) == ETCD_MAX_TXN_OPS {
-			child = NewEtcd(etcd)
-			split = append(split, child)
+// nestOps nests the operations in a tree of transactions that fits in the limit, the width is the minimal width of
+// the top level (the number of comparisons of the transaction).
+func nestOps(ops []clientv3.Op, width, limit int) []clientv3.Op {
+	if len(ops) <= limit {
+		return ops
+	}
+	if width < limit/2 {
+		width = limit / 2
+	}
+	if width < 2 || width >= limit {
+		/* doesn't fit, etcd rejects the transaction */
+		return ops
+	}
+	size := (len(ops) + width - 1) / width
+	nested := make([]clientv3.Op, 0, width)
+	for i := 0; i < len(ops); i += size {
+		end := i + size
+		if end > len(ops) {
+			end = len(ops)
 		}
+		nested = append(nested, clientv3.OpTxn(nil, nestOps(ops[i:end], 0, limit-width), nil))
 	}
-	return split
+	return nested
 }
 
-type TxnLock struct {
-	root      sync.Mutex
-	databases map[string]*sync.Mutex
+// unnestOps returns the responses of the operations nested by nestOps, the operations themselves are not transactions
+func unnestOps(responses []*etcdserverpb.ResponseOp) []*etcdserverpb.ResponseOp {
+	flat := []*etcdserverpb.ResponseOp{}
+	for _, r := range responses {
+		if nested := r.GetResponseTxn(); nested != nil {
+			flat = append(flat, unnestOps(nested.Responses)...)
+		} else {
+			flat = append(flat, r)
+		}
+	}
+	return flat
 }
 
 type Transaction struct {
 	/* logger */
 	log logr.Logger
 
-	/* lock */
-	lock *TxnLock
+	/* the start time of the transaction, the wait operations timeouts are relative to it */
+	startTime time.Time
+
+	/* the locks of the client, by lock id */
+	locks map[string]Locker
+	/* the assert operations of the transaction */
+	asserts []assertion
+	/* the transaction requested a durable commit */
+	durable bool
+	/* the owner of the ephemeral columns written by the transaction, without it they are not reset */
+	ephemeral *EphemeralOwner
+	/* the validators of the changes of the transaction */
+	validators []TransactionValidator
+	/* the transaction is executed but not committed, its changes are kept instead */
+	dryRun  bool
+	changes TableChanges
+	/* the comments of the transaction, they are kept in the transaction record */
+	comments []string
 
 	/* ovs */
 	schemas  libovsdb.Schemas
@@ -585,22 +721,30 @@ type Transaction struct {
 	cache   Cache
 	mapUUID MapUUID
 
+	/* the values of the rows as they were fetched from etcd, by key */
+	etcdValues map[string]string
+	/* the etcd revision of the fetched data */
+	revision int64
+
 	/* etcd */
 	etcd *Etcd
 }
 
-func NewTransaction(cli *clientv3.Client, log logr.Logger, request *libovsdb.Transact) *Transaction {
+func NewTransaction(ctx context.Context, cli *clientv3.Client, log logr.Logger, request *libovsdb.Transact) *Transaction {
 	txn := new(Transaction)
 	txn.log = log.WithValues()
 	txn.log.V(5).Info("new transaction", "size", len(request.Operations), "request", request)
 	txn.cache = Cache{}
 	txn.mapUUID = MapUUID{}
+	txn.etcdValues = map[string]string{}
+	txn.locks = map[string]Locker{}
 	txn.schemas = libovsdb.Schemas{}
 	txn.request = *request
 	txn.response.Result = make([]libovsdb.OperationResult, len(request.Operations))
 	txn.etcd = new(Etcd)
-	txn.etcd.Ctx = context.TODO()
+	txn.etcd.Ctx = ctx
 	txn.etcd.Cli = cli
+	txn.validators = enabledTransactionValidators()
 	return txn
 }
 
@@ -627,7 +771,188 @@ func (txn *Transaction) AddSchema(databaseSchema *libovsdb.DatabaseSchema) {
 	txn.schemas.Add(databaseSchema)
 }
 
+// waitBlocked is returned by a wait operation whose condition is not satisfied before its timeout expires. The
+// transaction is executed again when the waited table is modified, or when the timeout expires.
+type waitBlocked struct {
+	table    string
+	deadline time.Time
+}
+
+func (e *waitBlocked) Error() string {
+	return E_TIMEOUT
+}
+
 func (txn *Transaction) Commit() (int64, error) {
+	txn.startTime = time.Now()
+	/* the execution modifies the operations, so we keep the original request for the case it has to be re-executed */
+	var request []byte
+	request, err := json.Marshal(txn.request)
+	if err != nil {
+		err = errors.New(E_INTERNAL_ERROR)
+		txn.log.Error(err, "failed to marshal request")
+		return -1, err
+	}
+	retries := 0
+	for {
+		rev, err := txn.commit()
+		switch e := err.(type) {
+		case *waitBlocked:
+			txn.log.V(5).Info("wait blocked", "table", e.table, "deadline", e.deadline)
+			txn.waitForChange(e)
+			if txn.etcd.Ctx.Err() != nil {
+				err = errors.New(E_CANCELED)
+				txn.log.Error(err, "transaction canceled while blocked by wait")
+				errStr := err.Error()
+				txn.response.Error = &errStr
+				return -1, err
+			}
+		case *txnConflict:
+			if retries == TXN_MAX_RETRIES {
+				err = newOvsdbError(E_ABORTED, "The transaction conflicts with concurrent transactions, the database was modified since revision %d.", e.revision)
+				txn.log.Error(err, "etcd transaction compare failed", "revision", e.revision, "retries", retries)
+				txn.setOperationError(len(txn.request.Operations), err)
+				return -1, err
+			}
+			retries++
+			txn.log.V(5).Info("transaction conflict", "revision", e.revision, "retry", retries)
+		default:
+			return rev, err
+		}
+		if err = txn.reset(request); err != nil {
+			return -1, err
+		}
+	}
+}
+
+// txnConflict is returned by a transaction execution when the data it fetched was modified before the commit, the
+// transaction is re-executed in that case.
+type txnConflict struct {
+	revision int64
+}
+
+func (e *txnConflict) Error() string {
+	return E_ABORTED
+}
+
+// etcdReadCompares returns the etcd comparisons that hold as long as the data fetched by the read transaction is not
+// modified: every fetched row keeps its modification revision (it is not modified or deleted), and no row under the
+// fetched prefixes is created or modified after the read revision. If there are too many comparisons, the fetched
+// tables are compared as a whole: no row of the table is created or modified, and no row is deleted (by the deletion
+// key of the table, see etcdMarkDeletions).
+func (txn *Transaction) etcdReadCompares() []clientv3.Cmp {
+	prefixes := []string{}
+	for _, op := range txn.etcd.Then {
+		if op.IsGet() {
+			prefixes = append(prefixes, string(op.KeyBytes()))
+		}
+	}
+	sort.Strings(prefixes)
+	cmps := []clientv3.Cmp{}
+	last := ""
+	for _, prefix := range prefixes {
+		/* a prefix is covered by a shorter prefix that precedes it */
+		if last != "" && strings.HasPrefix(prefix, last) {
+			continue
+		}
+		last = prefix
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(prefix), "<", txn.revision+1).WithPrefix())
+	}
+	revisions := map[string]int64{}
+	for _, r := range txn.etcd.Res.Responses {
+		if v, ok := r.Response.(*etcdserverpb.ResponseOp_ResponseRange); ok {
+			for _, kv := range v.ResponseRange.Kvs {
+				revisions[string(kv.Key)] = kv.ModRevision
+			}
+		}
+	}
+	keys := make([]string, 0, len(revisions))
+	for key := range revisions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(cmps)+len(keys) > ETCD_MAX_READ_CMPS {
+		return txn.etcdReadTablesCompares(prefixes)
+	}
+	for _, key := range keys {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", revisions[key]))
+	}
+	return cmps
+}
+
+// etcdReadTablesCompares returns the comparisons of the tables of the fetched prefixes
+func (txn *Transaction) etcdReadTablesCompares(prefixes []string) []clientv3.Cmp {
+	dbKey := common.NewDBPrefixKey(txn.request.DBName)
+	tables := []string{}
+	for _, prefix := range prefixes {
+		table := strings.Split(strings.TrimPrefix(prefix, dbKey.DBKeyString()), common.KEY_DELIMETER)[0]
+		/* the prefixes are sorted */
+		if len(tables) == 0 || tables[len(tables)-1] != table {
+			tables = append(tables, table)
+		}
+	}
+	cmps := []clientv3.Cmp{}
+	for _, table := range tables {
+		tableKey := common.NewTableKey(txn.request.DBName, table)
+		deletionKey := common.NewDeletionKey(txn.request.DBName, table)
+		cmps = append(cmps,
+			clientv3.Compare(clientv3.ModRevision(tableKey.TableKeyString()), "<", txn.revision+1).WithPrefix(),
+			clientv3.Compare(clientv3.ModRevision(deletionKey.String()), "<", txn.revision+1))
+	}
+	return cmps
+}
+
+// etcdMarkDeletions modifies the deletion keys of the tables the transaction deletes rows from, so transactions that
+// compare the tables as a whole (see etcdReadTablesCompares) conflict with it.
+func (txn *Transaction) etcdMarkDeletions() {
+	tables := []string{}
+	for table := range txn.eventRows(mvccpb.DELETE) {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		key := common.NewDeletionKey(txn.request.DBName, table)
+		txn.etcd.Then = append(txn.etcd.Then, clientv3.OpPut(key.String(), ""))
+		txn.etcd.EventsNilCount++
+	}
+	txn.etcd.Assert()
+}
+
+// waitForChange returns when the table of the blocked wait operation is modified after the transaction revision, or
+// when the wait deadline expires.
+func (txn *Transaction) waitForChange(blocked *waitBlocked) {
+	ctx, cancel := context.WithDeadline(txn.etcd.Ctx, blocked.deadline)
+	defer cancel()
+	key := common.NewTableKey(txn.request.DBName, blocked.table)
+	wch := txn.etcd.Cli.Watch(ctx, key.TableKeyString(), clientv3.WithPrefix(), clientv3.WithRev(txn.revision+1))
+	for wresp := range wch {
+		if len(wresp.Events) > 0 || wresp.Err() != nil {
+			return
+		}
+	}
+}
+
+// reset restores the transaction to its initial state, so it can be executed again
+func (txn *Transaction) reset(request []byte) error {
+	txn.request = libovsdb.Transact{}
+	if err := json.Unmarshal(request, &txn.request); err != nil {
+		err = errors.New(E_INTERNAL_ERROR)
+		txn.log.Error(err, "failed to unmarshal request")
+		return err
+	}
+	txn.cache = Cache{}
+	txn.mapUUID = MapUUID{}
+	txn.etcdValues = map[string]string{}
+	txn.asserts = nil
+	txn.durable = false
+	txn.comments = nil
+	txn.revision = 0
+	txn.response = libovsdb.TransactResponse{}
+	txn.response.Result = make([]libovsdb.OperationResult, len(txn.request.Operations))
+	txn.etcd.Clear()
+	return nil
+}
+
+func (txn *Transaction) commit() (int64, error) {
 	var err error
 
 	/* verify that select is not intermixed with other operations */
@@ -653,67 +978,183 @@ func (txn *Transaction) Commit() (int64, error) {
 	for i, ovsOp := range txn.request.Operations {
 		err := ovsOpCallbackMap[ovsOp.Op][0](txn, &ovsOp, &txn.response.Result[i])
 		if err != nil {
-			errStr := err.Error()
-			txn.response.Result[i].SetError(errStr)
-			txn.response.Error = &errStr
+			txn.setOperationError(i, err)
 			return -1, err
 		}
 
 		if err = txn.cache.Validate(txn, txn.schemas); err != nil {
-			panic(fmt.Sprintf("validation of %s failed: %s", ovsOp, err.Error()))
+			err = validationError(err)
+			txn.log.Error(err, "validation failed", "operation", ovsOp, "details", errorDetails(err))
+			txn.setOperationError(i, err)
+			return -1, err
 		}
 	}
-	_, err = txn.etcdTranaction()
+	readResponse, err := txn.etcdTranaction()
 	if err != nil {
 		errStr := err.Error()
 		txn.response.Error = &errStr
 		return -1, err
 	}
+	txn.revision = readResponse.Header.Revision
+	readCmps := txn.etcdReadCompares()
 
-	/* commit actual transactional changes to database */
+	/* commit actual transactional changes to database, on condition that the fetched data was not modified */
 	txn.etcd.Clear()
+	txn.etcd.If = append(txn.etcd.If, readCmps...)
+	opEvents := make([]int, len(txn.request.Operations))
 	for i, ovsOp := range txn.request.Operations {
 		err = ovsOpCallbackMap[ovsOp.Op][1](txn, &ovsOp, &txn.response.Result[i])
 		if err != nil {
-			errStr := err.Error()
-			txn.response.Result[i].SetError(errStr)
-			txn.response.Error = &errStr
+			txn.setOperationError(i, err)
 			return -1, err
 		}
+		opEvents[i] = len(txn.etcd.Events)
 
 		if err = txn.cache.Validate(txn, txn.schemas); err != nil {
-			panic(fmt.Sprintf("validation of %s failed: %s", ovsOp, err.Error()))
+			err = validationError(err)
+			txn.log.Error(err, "validation failed", "operation", ovsOp, "details", errorDetails(err))
+			txn.setOperationError(i, err)
+			return -1, err
+		}
+	}
+
+	/* commit time constraints, reported as an additional result element */
+	if err = txn.checkReferences(); err != nil {
+		txn.setOperationError(len(txn.request.Operations), err)
+		return -1, err
+	}
+	if err = txn.checkIndexes(); err != nil {
+		txn.setOperationError(len(txn.request.Operations), err)
+		return -1, err
+	}
+	if err = txn.checkMaxRows(); err != nil {
+		txn.setOperationError(len(txn.request.Operations), err)
+		return -1, err
+	}
+	/* custom policies, reported as the errors of the operations that violate them */
+	if err = txn.validateChanges(opEvents); err != nil {
+		return -1, err
+	}
+	if txn.dryRun {
+		if txn.changes, err = txn.tableChanges(opEvents); err != nil {
+			txn.setOperationError(len(txn.request.Operations), err)
+			return -1, err
 		}
+		txn.log.V(5).Info("dry run transaction", "response", txn.response)
+		return txn.revision, nil
 	}
 
 	//txn.log.V(5).Info("events transaction", "events", txn.etcd.EventsDump())
 	txn.etcdRemoveDup()
 	//txn.log.V(5).Info("events transaction (remove dup)", "events", txn.etcd.EventsDump())
+	txn.etcdMarkDeletions()
+	if err = txn.etcdMarkEphemerals(); err != nil {
+		errStr := err.Error()
+		txn.response.Error = &errStr
+		return -1, err
+	}
+	if err = txn.etcdMarkTransaction(); err != nil {
+		errStr := err.Error()
+		txn.response.Error = &errStr
+		return -1, err
+	}
 	trResponse, err := txn.etcdTranaction()
 	if err != nil {
 		errStr := err.Error()
 		txn.response.Error = &errStr
 		return -1, err
 	}
+	if !trResponse.Succeeded {
+		if txn.lockLost(trResponse) {
+			return -1, errors.New(E_NOT_OWNER)
+		}
+		return -1, &txnConflict{revision: txn.revision}
+	}
+	if txn.durable {
+		/* the transaction is committed, so its results are replied even if the durability is not confirmed */
+		txn.confirmDurable(trResponse.Header.Revision)
+	}
 
 	txn.log.V(5).Info("commit transaction", "response", txn.response)
 	return trResponse.Header.Revision, nil
 }
 
+// setOperationError reports err as the result of the i'th operation. Errors that are detected after all the
+// operations were executed (e.g. index violations) are reported with i == len(operations), according to RFC 7047
+// section 4.1.3 they are appended as an additional element to the result array.
+func (txn *Transaction) setOperationError(i int, err error) {
+	errStr := err.Error()
+	if i == len(txn.response.Result) {
+		txn.response.Result = append(txn.response.Result, libovsdb.OperationResult{})
+	}
+	txn.response.Result[i].SetError(errStr)
+	if details := errorDetails(err); details != "" {
+		txn.response.Result[i].Details = &details
+	}
+	txn.response.Error = &errStr
+}
+
+// Results returns the results of the operations. If the transaction failed without an error of a specific operation
+// (e.g. an etcd failure), the error is reported by an additional element, according to RFC 7047 section 4.1.3.
+func (txn *Transaction) Results(err error) []libovsdb.OperationResult {
+	if err == nil {
+		return txn.response.Result
+	}
+	for _, result := range txn.response.Result {
+		if result.Error != nil {
+			return txn.response.Result
+		}
+	}
+	txn.setOperationError(len(txn.response.Result), err)
+	return txn.response.Result
+}
+
 // XXX: move to db
+// makeValue returns the value of the row as it is stored in etcd, without the _uuid and _version columns: the uuid of
+// a row is the last element of its key, and its version is derived from the modification revision of the key.
 func makeValue(row *map[string]interface{}) (string, error) {
-	b, err := json.Marshal(*row)
+	value := make(map[string]interface{}, len(*row))
+	for column, v := range *row {
+		if column != COL_UUID && column != COL_VERSION {
+			value[column] = v
+		}
+	}
+	b, err := json.Marshal(value)
 	if err != nil {
 		return "", err
 	}
 	return string(b), nil
 }
 
-// TODO: we should not add uuid to etcd
 func setRowUUID(row *map[string]interface{}, uuid string) {
 	(*row)[COL_UUID] = libovsdb.UUID{GoUUID: uuid}
 }
 
+// setRowVersion sets the _version of the row by the etcd modification revision of the row, so every modification of
+// the row changes its version.
+func setRowVersion(row *map[string]interface{}, revision int64) {
+	(*row)[COL_VERSION] = libovsdb.UUID{GoUUID: revisionUUID(revision)}
+}
+
+// revisionUUID returns the UUID of an etcd revision, it is the version of the rows that were written at the revision,
+// and the id of the transaction that was committed at the revision
+func revisionUUID(revision int64) string {
+	return fmt.Sprintf("%08x-0000-4000-8000-%012x", uint64(revision)>>48, uint64(revision)&0xffffffffffff)
+}
+
+// uuidRevision returns the etcd revision of a UUID that was returned by revisionUUID
+func uuidRevision(uuid string) (int64, error) {
+	var high, low uint64
+	if _, err := fmt.Sscanf(uuid, "%08x-0000-4000-8000-%012x", &high, &low); err != nil {
+		return 0, fmt.Errorf("%q is not a revision uuid: %s", uuid, err.Error())
+	}
+	revision := int64(high<<48 | low)
+	if revision <= 0 || revisionUUID(revision) != uuid {
+		return 0, fmt.Errorf("%q is not a revision uuid", uuid)
+	}
+	return revision, nil
+}
+
 const (
 	FN_LT = "<"
 	FN_LE = "<="
@@ -774,7 +1215,7 @@ func NewCondition(txn *Transaction, tableSchema *libovsdb.TableSchema, mapUUID M
 			return nil, err
 		}
 		value = tmp
-	} else if column == COL_UUID {
+	} else {
 		tmp, err := libovsdb.UnmarshalUUID(value)
 		if err != nil {
 			err = errors.New(E_INTERNAL_ERROR)
@@ -930,6 +1371,8 @@ func (c *Condition) CompareUUID(row *map[string]interface{}) (bool, error) {
 	ar, ok := (*row)[c.Column].([]interface{})
 	if ok {
 		actual = libovsdb.UUID{GoUUID: ar[1].(string)}
+	} else if (*row)[c.Column] == nil && c.Column == COL_VERSION {
+		/* the row is inserted by the transaction, its version is set by the commit */
 	} else {
 		actual, ok = (*row)[c.Column].(libovsdb.UUID)
 		if !ok {
@@ -1020,12 +1463,8 @@ func (c *Condition) CompareMap(row *map[string]interface{}) (bool, error) {
 func (c *Condition) Compare(row *map[string]interface{}) (bool, error) {
 	var err error
 	switch c.Column {
-	case COL_UUID:
+	case COL_UUID, COL_VERSION:
 		return c.CompareUUID(row)
-	case COL_VERSION:
-		err = errors.New(E_CONSTRAINT_VIOLATION)
-		c.txn.log.Error(err, "unsupported field comparison", "column", COL_VERSION)
-		return false, err
 	}
 
 	switch c.ColumnSchema.Type {
@@ -1166,6 +1605,7 @@ type Mutation struct {
 	Mutator      string
 	Value        interface{}
 	ColumnSchema *libovsdb.ColumnSchema
+	table        string
 	txn          *Transaction
 }
 
@@ -1200,12 +1640,13 @@ func NewMutation(txn *Transaction, tableSchema *libovsdb.TableSchema, mapUUID Ma
 
 	value := mutation[2]
 
-	value, err = columnSchema.Unmarshal(value)
+	tmp, err := columnSchema.Unmarshal(value)
 	if err != nil {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
+		err = validationError(&libovsdb.ValidationError{Table: tableSchema.Name, Column: column, Value: value, Reason: err.Error()})
 		txn.log.Error(err, "failed unmarshal of column", "column", column)
 		return nil, err
 	}
+	value = tmp
 
 	value, err = mapUUID.Resolv(txn, value)
 	if err != nil {
@@ -1216,7 +1657,7 @@ func NewMutation(txn *Transaction, tableSchema *libovsdb.TableSchema, mapUUID Ma
 
 	err = columnSchema.Validate(value)
 	if err != nil {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
+		err = validationError(&libovsdb.ValidationError{Table: tableSchema.Name, Column: column, Value: value, Reason: err.Error()})
 		txn.log.Error(err, "failed validate of column", "column", column)
 		return nil, err
 	}
@@ -1226,46 +1667,64 @@ func NewMutation(txn *Transaction, tableSchema *libovsdb.TableSchema, mapUUID Ma
 		Mutator:      mt,
 		Value:        value,
 		ColumnSchema: columnSchema,
+		table:        tableSchema.Name,
 		txn:          txn,
 	}, nil
 }
 
-func (m *Mutation) MutateInteger(row *map[string]interface{}) error {
-	var err error
-	original := (*row)[m.Column].(int)
-	value, ok := m.Value.(int)
-	if !ok {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
-		m.txn.log.Error(err, "can't convert mutation value", "value", m.Value)
-		return err
-	}
-	mutated := original
+const (
+	maxInt = int(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+// mutateInteger applies an arithmetic mutator on an integer, the result has to be representable (RFC 7047 section
+// 5.2.6 "range error") and mathematically defined ("domain error").
+func (m *Mutation) mutateInteger(original, value int) (int, error) {
+	overflow := false
+	var mutated int
 	switch m.Mutator {
 	case MT_SUM:
-		mutated += value
+		overflow = (value > 0 && original > maxInt-value) || (value < 0 && original < minInt-value)
+		mutated = original + value
 	case MT_DIFFERENCE:
-		mutated -= value
+		overflow = (value < 0 && original > maxInt+value) || (value > 0 && original < minInt+value)
+		mutated = original - value
 	case MT_PRODUCT:
-		mutated *= value
+		mutated = original * value
+		overflow = original != 0 && (mutated/original != value || (original == -1 && value == minInt))
 	case MT_QUOTIENT:
-		if value != 0 {
-			mutated /= value
-		} else {
-			err = errors.New(E_DOMAIN_ERROR)
-			m.txn.log.Error(err, "can't devide by 0")
-			return err
+		if value == 0 {
+			return 0, newOvsdbError(E_DOMAIN_ERROR, "Division by zero in mutation of column %q of table %q.", m.Column, m.table)
 		}
+		overflow = original == minInt && value == -1
+		mutated = original / value
 	case MT_REMAINDER:
-		if value != 0 {
-			mutated %= value
-		} else {
-			err = errors.New(E_DOMAIN_ERROR)
-			m.txn.log.Error(err, "can't modulo by 0")
-			return err
+		if value == 0 {
+			return 0, newOvsdbError(E_DOMAIN_ERROR, "Modulo by zero in mutation of column %q of table %q.", m.Column, m.table)
 		}
+		mutated = original % value
 	default:
+		return 0, errors.New(E_CONSTRAINT_VIOLATION)
+	}
+	if overflow {
+		return 0, newOvsdbError(E_RANGE_ERROR, "Result of \"%d %s %d\" in column %q of table %q is not representable as an integer.",
+			original, m.Mutator, value, m.Column, m.table)
+	}
+	return mutated, nil
+}
+
+func (m *Mutation) MutateInteger(row *map[string]interface{}) error {
+	var err error
+	original := (*row)[m.Column].(int)
+	value, ok := m.Value.(int)
+	if !ok {
 		err = errors.New(E_CONSTRAINT_VIOLATION)
-		m.txn.log.Error(err, "unsupported mutator", "mutator", m.Mutator)
+		m.txn.log.Error(err, "can't convert mutation value", "value", m.Value)
+		return err
+	}
+	mutated, err := m.mutateInteger(original, value)
+	if err != nil {
+		m.txn.log.Error(err, "failed integer mutation", "mutator", m.Mutator, "details", errorDetails(err))
 		return err
 	}
 	(*row)[m.Column] = mutated
@@ -1293,7 +1752,7 @@ func (m *Mutation) MutateReal(row *map[string]interface{}) error {
 		if value != 0 {
 			mutated /= value
 		} else {
-			err = errors.New(E_DOMAIN_ERROR)
+			err = newOvsdbError(E_DOMAIN_ERROR, "Division by zero in mutation of column %q of table %q.", m.Column, m.table)
 			m.txn.log.Error(err, "can't devide by 0")
 			return err
 		}
@@ -1302,6 +1761,12 @@ func (m *Mutation) MutateReal(row *map[string]interface{}) error {
 		m.txn.log.Error(err, "unsupported mutator", "mutator", m.Mutator)
 		return err
 	}
+	if math.IsInf(mutated, 0) || math.IsNaN(mutated) {
+		err = newOvsdbError(E_RANGE_ERROR, "Result of \"%g %s %g\" in column %q of table %q is not representable as a real.",
+			original, m.Mutator, value, m.Column, m.table)
+		m.txn.log.Error(err, "failed real mutation", "details", errorDetails(err))
+		return err
+	}
 	(*row)[m.Column] = mutated
 	return nil
 }
@@ -1447,18 +1912,28 @@ func (m *Mutation) Mutate(row *map[string]interface{}) error {
 	}
 	switch m.ColumnSchema.Type {
 	case libovsdb.TypeInteger:
-		return m.MutateInteger(row)
+		err = m.MutateInteger(row)
 	case libovsdb.TypeReal:
-		return m.MutateReal(row)
+		err = m.MutateReal(row)
 	case libovsdb.TypeSet:
-		return m.MutateSet(row)
+		err = m.MutateSet(row)
 	case libovsdb.TypeMap:
-		return m.MutateMap(row)
+		err = m.MutateMap(row)
 	default:
 		err = errors.New(E_CONSTRAINT_VIOLATION)
 		m.txn.log.Error(err, "unsupported column schema type", "type", m.ColumnSchema.Type)
+	}
+	if err != nil {
+		return err
+	}
+	/* the mutated value has to satisfy the constraints of the column (bounds, enum, set and map size) */
+	value := (*row)[m.Column]
+	if err = m.ColumnSchema.Validate(value); err != nil {
+		err = validationError(&libovsdb.ValidationError{Table: m.table, Column: m.Column, Value: value, Reason: err.Error()})
+		m.txn.log.Error(err, "mutation violates the column constraints", "details", errorDetails(err))
 		return err
 	}
+	return nil
 }
 
 func (txn *Transaction) RowMutate(tableSchema *libovsdb.TableSchema, mapUUID MapUUID, original *map[string]interface{}, mutations *[]interface{}) error {
@@ -1515,6 +1990,52 @@ func columnUpdate(columnSchema *libovsdb.ColumnSchema, oldValue, newValue interf
 	}
 }
 
+// columnDiff returns the difference between the values of a column, in the format of the "modify" member of
+// <row-update2>: the elements that were added to or removed from a set, the pairs of a map that were added or removed
+// and the new values of the modified pairs, and the new value of other columns.
+func columnDiff(columnSchema *libovsdb.ColumnSchema, oldValue, newValue interface{}) interface{} {
+	switch columnSchema.Type {
+	case libovsdb.TypeSet:
+		oldSet, oldOK := oldValue.(libovsdb.OvsSet)
+		newSet, newOK := newValue.(libovsdb.OvsSet)
+		if !oldOK || !newOK {
+			return newValue
+		}
+		retSet := libovsdb.OvsSet{GoSet: []interface{}{}}
+		for _, v := range newSet.GoSet {
+			if !inSet(&oldSet, v) {
+				retSet.GoSet = append(retSet.GoSet, v)
+			}
+		}
+		for _, v := range oldSet.GoSet {
+			if !inSet(&newSet, v) {
+				retSet.GoSet = append(retSet.GoSet, v)
+			}
+		}
+		return retSet
+	case libovsdb.TypeMap:
+		oldMap, oldOK := oldValue.(libovsdb.OvsMap)
+		newMap, newOK := newValue.(libovsdb.OvsMap)
+		if !oldOK || !newOK {
+			return newValue
+		}
+		retMap := libovsdb.OvsMap{GoMap: map[interface{}]interface{}{}}
+		for k, v := range newMap.GoMap {
+			if oldV, ok := oldMap.GoMap[k]; !ok || !isEqualValue(oldV, v) {
+				retMap.GoMap[k] = v
+			}
+		}
+		for k, v := range oldMap.GoMap {
+			if _, ok := newMap.GoMap[k]; !ok {
+				retMap.GoMap[k] = v
+			}
+		}
+		return retMap
+	default:
+		return newValue
+	}
+}
+
 func (txn *Transaction) RowUpdate(tableSchema *libovsdb.TableSchema, mapUUID MapUUID, original *map[string]interface{}, update *map[string]interface{}) error {
 	for column, value := range *update {
 		columnSchema, err := tableSchema.LookupColumn(column)
@@ -1623,6 +2144,22 @@ func etcdEventDelete(key, prevVal string) *clientv3.Event {
 	}
 }
 
+// etcdEventsSetRevision sets the revision of the commit to the events of a transaction, and the key to its delete
+// events, as the events of the etcd watch have them
+func etcdEventsSetRevision(events []*clientv3.Event, revision int64) {
+	for _, ev := range events {
+		switch {
+		case ev.Type == mvccpb.DELETE && ev.Kv == nil && ev.PrevKv != nil:
+			ev.Kv = &mvccpb.KeyValue{Key: ev.PrevKv.Key, ModRevision: revision}
+		case etcdEventIsCreate(ev):
+			ev.Kv.CreateRevision = revision
+			ev.Kv.ModRevision = revision
+		case ev.Kv != nil:
+			ev.Kv.ModRevision = revision
+		}
+	}
+}
+
 func etcdCreateRow(txn *Transaction, k *common.Key, row *map[string]interface{}) error {
 	key := k.String()
 	val, err := makeValue(row)
@@ -1650,8 +2187,7 @@ func etcdModifyRow(txn *Transaction, k *common.Key, row *map[string]interface{})
 	etcdOp := clientv3.OpPut(key, val)
 	txn.etcd.Then = append(txn.etcd.Then, etcdOp)
 
-	prevRow := txn.cache.Row(*k)
-	prevVal, err := makeValue(prevRow)
+	prevVal, err := txn.etcdPrevValue(k)
 	if err != nil {
 		return err
 	}
@@ -1668,7 +2204,7 @@ func etcdDeleteRow(txn *Transaction, k *common.Key) error {
 	etcdOp := clientv3.OpDelete(key)
 	txn.etcd.Then = append(txn.etcd.Then, etcdOp)
 
-	prevVal, err := makeValue(txn.cache.Row(*k))
+	prevVal, err := txn.etcdPrevValue(k)
 	if err != nil {
 		return err
 	}
@@ -1684,8 +2220,8 @@ func (txn *Transaction) RowPrepare(tableSchema *libovsdb.TableSchema, mapUUID Ma
 	log := txn.log.WithValues("row", row)
 	err := tableSchema.Unmarshal(row)
 	if err != nil {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
-		log.Error(err, "failed to unmarshal row")
+		err = validationError(err)
+		log.Error(err, "failed to unmarshal row", "details", errorDetails(err))
 		return err
 	}
 
@@ -1698,34 +2234,807 @@ func (txn *Transaction) RowPrepare(tableSchema *libovsdb.TableSchema, mapUUID Ma
 
 	err = tableSchema.Validate(row)
 	if err != nil {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
-		txn.log.Error(err, "failed schema validation of row")
+		err = validationError(err)
+		log.Error(err, "failed schema validation of row", "details", errorDetails(err))
 		return err
 	}
 	return nil
 }
 
-/* insert */
-func preInsert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
-	var err error
-	if ovsOp.UUIDName == nil {
-		return nil
-	}
-
-	if ovsOp.UUIDName != nil {
-		uuid := common.GenerateUUID()
-		if ovsOp.UUID != nil {
-			uuid = ovsOp.UUID.GoUUID
+/* indexes */
+func indexValue(value interface{}) (string, error) {
+	var elements []string
+	switch v := value.(type) {
+	case libovsdb.OvsSet:
+		if len(v.GoSet) == 1 {
+			/* a set with a single element is equal to the element itself */
+			return indexValue(v.GoSet[0])
 		}
-		if _, ok := txn.mapUUID[*ovsOp.UUIDName]; ok {
-			err = errors.New(E_DUP_UUIDNAME)
-			txn.log.Error(err, "duplicate uuid-name", "uuid-name", *ovsOp.UUIDName)
-			return err
+		for _, element := range v.GoSet {
+			b, err := json.Marshal(element)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, string(b))
 		}
-		txn.mapUUID.Set(txn, *ovsOp.UUIDName, uuid)
+	case libovsdb.OvsMap:
+		for key, val := range v.GoMap {
+			b, err := json.Marshal([]interface{}{key, val})
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, string(b))
+		}
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
 	}
+	/* sets and maps are unordered, so we compare their sorted elements */
+	sort.Strings(elements)
+	return "[" + strings.Join(elements, ",") + "]", nil
+}
 
-	key := common.NewTableKey(txn.request.DBName, *ovsOp.Table)
+func rowIndexValue(tableSchema *libovsdb.TableSchema, index []string, row *map[string]interface{}) (string, error) {
+	values := []string{}
+	for _, column := range index {
+		if _, err := tableSchema.LookupColumn(column); err != nil {
+			return "", err
+		}
+		value, err := indexValue((*row)[column])
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// the uuids of the rows changed by the transaction (mvccpb.PUT for inserted or modified rows, mvccpb.DELETE for
+// deleted rows), per table
+func (txn *Transaction) eventRows(eventType mvccpb.Event_EventType) map[string]map[string]bool {
+	rows := map[string]map[string]bool{}
+	for _, ev := range txn.etcd.Events {
+		if ev == nil || ev.Type != eventType {
+			continue
+		}
+		key, err := common.ParseKey(etcdEventKey(ev))
+		if err != nil {
+			continue
+		}
+		if _, ok := rows[key.TableName]; !ok {
+			rows[key.TableName] = map[string]bool{}
+		}
+		rows[key.TableName][key.UUID] = true
+	}
+	return rows
+}
+
+// checkIndexes verifies that the rows inserted or modified by the transaction don't break the uniqueness of the
+// table indexes, neither against the existing rows nor against other rows of the same transaction.
+func (txn *Transaction) checkIndexes() error {
+	for table, uuids := range txn.eventRows(mvccpb.PUT) {
+		tableSchema, err := txn.schemas.LookupTable(txn.request.DBName, table)
+		if err != nil {
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		if len(tableSchema.Indexes) == 0 {
+			continue
+		}
+		tableCache := txn.cache.Table(txn.request.DBName, table)
+		rows := make([]string, 0, len(tableCache))
+		for uuid := range tableCache {
+			rows = append(rows, uuid)
+		}
+		sort.Strings(rows)
+		for _, index := range tableSchema.Indexes {
+			indexed := map[string]string{}
+			for _, uuid := range rows {
+				value, err := rowIndexValue(tableSchema, index, tableCache[uuid])
+				if err != nil {
+					err = errors.New(E_INTERNAL_ERROR)
+					txn.log.Error(err, "failed to compute index value", "table", table, "index", index, "uuid", uuid)
+					return err
+				}
+				other, ok := indexed[value]
+				if !ok {
+					indexed[value] = uuid
+					continue
+				}
+				if !uuids[uuid] && !uuids[other] {
+					/* the both rows are not modified by the transaction */
+					continue
+				}
+				err = newOvsdbError(E_CONSTRAINT_VIOLATION,
+					"Transaction causes multiple rows in %q table to have identical values (%s) for index on column(s) %q. First row, with UUID %s, second row, with UUID %s.",
+					table, value, index, other, uuid)
+				txn.log.Error(err, "index violation", "details", errorDetails(err))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/* max rows */
+
+// checkMaxRows verifies that the tables the transaction writes to don't exceed their maxRows limit. The limit is
+// checked against the rows fetched at txn.revision, a row added to the table since then fails the commit by the read
+// comparisons (see etcdReadCompares), as the entire table is fetched.
+func (txn *Transaction) checkMaxRows() error {
+	for table := range txn.eventRows(mvccpb.PUT) {
+		tableSchema, err := txn.schemas.LookupTable(txn.request.DBName, table)
+		if err != nil {
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		if tableSchema.MaxRows <= 0 {
+			continue
+		}
+		rows := len(txn.cache.Table(txn.request.DBName, table))
+		if rows > tableSchema.MaxRows {
+			err = newOvsdbError(E_CONSTRAINT_VIOLATION,
+				"Transaction causes %q table to contain %d rows, greater than the schema-defined limit of %d row(s).",
+				table, rows, tableSchema.MaxRows)
+			txn.log.Error(err, "max rows violation", "details", errorDetails(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// etcdGetConstrainedTable fetches the entire table if it has indexes or a rows limit, so that a new or modified row can
+// be checked against all the existing rows.
+func etcdGetConstrainedTable(txn *Transaction, table string) error {
+	tableSchema, err := txn.schemas.LookupTable(txn.request.DBName, table)
+	if err != nil {
+		return errors.New(E_INTERNAL_ERROR)
+	}
+	if len(tableSchema.Indexes) == 0 && tableSchema.MaxRows <= 0 {
+		return nil
+	}
+	key := common.NewTableKey(txn.request.DBName, table)
+	etcdGetData(txn, &key)
+	return nil
+}
+
+/* references */
+type columnRef struct {
+	table  string
+	strong bool
+}
+
+func baseTypeRef(baseType *libovsdb.BaseType) *columnRef {
+	if baseType == nil || baseType.Type != libovsdb.TypeUUID || baseType.RefTable == "" {
+		return nil
+	}
+	/* according to RFC 7047 the default reference type is strong */
+	return &columnRef{table: baseType.RefTable, strong: baseType.RefType != libovsdb.Weak}
+}
+
+// columnRefs returns the references of the column keys and values (the later only for maps)
+func columnRefs(columnSchema *libovsdb.ColumnSchema) (*columnRef, *columnRef) {
+	if columnSchema.TypeObj == nil {
+		return nil, nil
+	}
+	return baseTypeRef(columnSchema.TypeObj.Key), baseTypeRef(columnSchema.TypeObj.Value)
+}
+
+func refUUID(value interface{}) (string, bool) {
+	uuid, ok := value.(libovsdb.UUID)
+	return uuid.GoUUID, ok
+}
+
+// isRootTable returns true if the rows of the table are not garbage collected. According to RFC 7047 section 3.1, if
+// none of the database tables is a root table, then all of them are root tables.
+func isRootTable(databaseSchema *libovsdb.DatabaseSchema, table string) bool {
+	for _, tableSchema := range databaseSchema.Tables {
+		if tableSchema.IsRoot {
+			return databaseSchema.Tables[table].IsRoot
+		}
+	}
+	return true
+}
+
+func sortedUUIDs(tableCache TableCache) []string {
+	uuids := make([]string, 0, len(tableCache))
+	for uuid := range tableCache {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+func sortedColumns(tableSchema *libovsdb.TableSchema) []string {
+	columns := make([]string, 0, len(tableSchema.Columns))
+	for column := range tableSchema.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// forEachRef calls f for every reference of the row, including weak references
+func forEachRef(tableSchema *libovsdb.TableSchema, row *map[string]interface{}, f func(column string, ref *columnRef, uuid string) error) error {
+	for _, column := range sortedColumns(tableSchema) {
+		keyRef, valueRef := columnRefs(tableSchema.Columns[column])
+		if keyRef == nil && valueRef == nil {
+			continue
+		}
+		visit := func(ref *columnRef, value interface{}) error {
+			if ref == nil {
+				return nil
+			}
+			if uuid, ok := refUUID(value); ok {
+				return f(column, ref, uuid)
+			}
+			return nil
+		}
+		switch value := (*row)[column].(type) {
+		case libovsdb.OvsSet:
+			for _, element := range value.GoSet {
+				if err := visit(keyRef, element); err != nil {
+					return err
+				}
+			}
+		case libovsdb.OvsMap:
+			for key, val := range value.GoMap {
+				if err := visit(keyRef, key); err != nil {
+					return err
+				}
+				if err := visit(valueRef, val); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := visit(keyRef, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rowRef identifies a referenced row
+type rowRef struct {
+	table string
+	uuid  string
+}
+
+func sortedRowRefs(refs map[rowRef]bool) []rowRef {
+	sorted := make([]rowRef, 0, len(refs))
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].table != sorted[j].table {
+			return sorted[i].table < sorted[j].table
+		}
+		return sorted[i].uuid < sorted[j].uuid
+	})
+	return sorted
+}
+
+// txnRefs is the state of the references checks of a transaction. Only the rows whose references are changed by the
+// transaction are fetched: the targets of the added and removed references, and the tables that refer to the tables of
+// the deleted rows and of the garbage collection candidates.
+type txnRefs struct {
+	txn    *Transaction
+	schema *libovsdb.DatabaseSchema
+	// the tables that refer to a table, by any reference and by strong references
+	referrers       map[string]map[string]bool
+	strongReferrers map[string]map[string]bool
+	// the tables that were entirely fetched
+	fetched map[string]bool
+	// the rows that don't exist after the transaction, the deleted rows and the fetched rows that were not found
+	missing map[rowRef]bool
+	// the tables of the rows deleted by the transaction
+	deleted map[string]bool
+}
+
+func newTxnRefs(txn *Transaction, databaseSchema *libovsdb.DatabaseSchema) *txnRefs {
+	r := &txnRefs{
+		txn:             txn,
+		schema:          databaseSchema,
+		referrers:       map[string]map[string]bool{},
+		strongReferrers: map[string]map[string]bool{},
+		fetched:         map[string]bool{},
+		missing:         map[rowRef]bool{},
+		deleted:         map[string]bool{},
+	}
+	addReferrer := func(referrers map[string]map[string]bool, table, referrer string) {
+		if _, ok := referrers[table]; !ok {
+			referrers[table] = map[string]bool{}
+		}
+		referrers[table][referrer] = true
+	}
+	for table, tableSchema := range databaseSchema.Tables {
+		for _, columnSchema := range tableSchema.Columns {
+			keyRef, valueRef := columnRefs(columnSchema)
+			for _, ref := range []*columnRef{keyRef, valueRef} {
+				if ref == nil {
+					continue
+				}
+				addReferrer(r.referrers, ref.table, table)
+				if ref.strong {
+					addReferrer(r.strongReferrers, ref.table, table)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// needed returns false if the schema has neither references nor non-root tables
+func (r *txnRefs) needed() bool {
+	if len(r.referrers) > 0 {
+		return true
+	}
+	for table := range r.schema.Tables {
+		if !isRootTable(r.schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// referrerTables returns the sorted tables that refer to the tables
+func referrerTables(referrers map[string]map[string]bool, tables map[string]bool) []string {
+	set := map[string]bool{}
+	for table := range tables {
+		for referrer := range referrers[table] {
+			set[referrer] = true
+		}
+	}
+	sorted := make([]string, 0, len(set))
+	for table := range set {
+		sorted = append(sorted, table)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// countRefs returns the number of the references of the row to every row, by all the references and by the strong
+// ones. A nil row has no references.
+func countRefs(tableSchema *libovsdb.TableSchema, row *map[string]interface{}) (map[rowRef]int, map[rowRef]int) {
+	all := map[rowRef]int{}
+	strong := map[rowRef]int{}
+	if row == nil {
+		return all, strong
+	}
+	forEachRef(tableSchema, row, func(column string, ref *columnRef, uuid string) error {
+		all[rowRef{table: ref.table, uuid: uuid}]++
+		if ref.strong {
+			strong[rowRef{table: ref.table, uuid: uuid}]++
+		}
+		return nil
+	})
+	return all, strong
+}
+
+// storedRow returns the row as it was stored before the transaction, or nil if the transaction inserted it
+func (r *txnRefs) storedRow(table, key string) (*map[string]interface{}, error) {
+	val, ok := r.txn.etcdValues[key]
+	if !ok {
+		return nil, nil
+	}
+	row, err := unmarshalStoredRow([]byte(val))
+	if err != nil {
+		return nil, err
+	}
+	if err = r.txn.schemas.Unmarshal(r.txn.request.DBName, table, &row); err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// fetch fetches the rows and the tables that are not in the cache, the rows that are not found don't exist
+func (r *txnRefs) fetch(rows []rowRef, tables []string) error {
+	if err := r.etcdGet(rows, tables); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, ok := r.txn.cache.Table(r.txn.request.DBName, row.table)[row.uuid]; !ok {
+			r.missing[row] = true
+		}
+	}
+	return nil
+}
+
+// etcdGet gets the rows and the tables that are not in the cache, at the revision of the transaction. The fetched
+// rows are added to the cache without overriding the rows changed by the transaction, and the commit is conditioned
+// on them as on the rows fetched by the operations (see etcdReadCompares).
+func (r *txnRefs) etcdGet(rows []rowRef, tables []string) error {
+	txn := r.txn
+	dbname := txn.request.DBName
+	etcd := NewEtcd(txn.etcd)
+	fetchedTables := []string{}
+	for _, table := range tables {
+		if r.fetched[table] {
+			continue
+		}
+		r.fetched[table] = true
+		key := common.NewTableKey(dbname, table)
+		etcd.Then = append(etcd.Then, clientv3.OpGet(key.String(), clientv3.WithPrefix(), clientv3.WithRev(txn.revision)))
+		fetchedTables = append(fetchedTables, key.String())
+	}
+	fetchedRows := []rowRef{}
+	for _, row := range rows {
+		if r.fetched[row.table] || r.missing[row] {
+			continue
+		}
+		if _, ok := txn.cache.Table(dbname, row.table)[row.uuid]; ok {
+			continue
+		}
+		key := common.NewDataKey(dbname, row.table, row.uuid)
+		etcd.Then = append(etcd.Then, clientv3.OpGet(key.String(), clientv3.WithRev(txn.revision)))
+		fetchedRows = append(fetchedRows, row)
+	}
+	if len(etcd.Then) == 0 {
+		return nil
+	}
+	txn.log.V(6).Info("get references", "rows", len(fetchedRows), "tables", fetchedTables)
+	err := etcd.Commit()
+	switch {
+	case err == rpctypes.ErrCompacted:
+		/* the transaction is executed again at a new revision */
+		return &txnConflict{revision: txn.revision}
+	case err != nil && etcd.Ctx.Err() != nil:
+		txn.log.Error(err, "get references")
+		return errors.New(E_CANCELED)
+	case err != nil:
+		txn.log.Error(err, "get references")
+		return errors.New(E_IO_ERROR)
+	}
+	cache := Cache{}
+	cache.GetFromEtcd(etcd.Res)
+	if err = cache.Unmarshal(txn, txn.schemas); err != nil {
+		return validationError(err)
+	}
+	txn.keepEtcdValues(etcd.Res)
+	for table, tableCache := range cache.Database(dbname) {
+		txnTableCache := txn.cache.Table(dbname, table)
+		for uuid, row := range tableCache {
+			if _, ok := txnTableCache[uuid]; ok || r.missing[rowRef{table: table, uuid: uuid}] {
+				continue
+			}
+			txnTableCache[uuid] = row
+		}
+	}
+
+	/* the fetched rows keep their revisions, the missing rows are not created, and the fetched tables are not changed */
+	revisions := map[string]int64{}
+	for _, res := range etcd.Res.Responses {
+		if rangeResp := res.GetResponseRange(); rangeResp != nil {
+			for _, kv := range rangeResp.Kvs {
+				revisions[string(kv.Key)] = kv.ModRevision
+			}
+		}
+	}
+	cmps := []clientv3.Cmp{}
+	rowsPrefixes := []string{}
+	for _, row := range fetchedRows {
+		key := common.NewDataKey(dbname, row.table, row.uuid)
+		rowsPrefixes = append(rowsPrefixes, key.String())
+		/* the revision of a missing row is 0 */
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key.String()), "=", revisions[key.String()]))
+	}
+	if len(txn.etcd.If)+len(cmps) > ETCD_MAX_READ_CMPS {
+		sort.Strings(rowsPrefixes)
+		cmps = txn.etcdReadTablesCompares(rowsPrefixes)
+	}
+	txn.etcd.If = append(txn.etcd.If, cmps...)
+	txn.etcd.If = append(txn.etcd.If, txn.etcdReadTablesCompares(fetchedTables)...)
+	return nil
+}
+
+// checkReferences applies the references semantics at commit time: garbage collection of unreferenced rows in
+// non-root tables, removal of dangling weak references and referential integrity of strong references. Only the rows
+// whose references are changed by the transaction are checked, the stored references are valid.
+func (txn *Transaction) checkReferences() error {
+	databaseSchema, ok := txn.schemas[txn.request.DBName]
+	if !ok {
+		return nil
+	}
+	r := newTxnRefs(txn, databaseSchema)
+	if !r.needed() {
+		return nil
+	}
+	dbname := txn.request.DBName
+	changed := map[string]*common.Key{}
+	for _, ev := range txn.etcd.Events {
+		if ev == nil {
+			continue
+		}
+		key, err := common.ParseKey(etcdEventKey(ev))
+		if err != nil {
+			txn.log.Error(err, "parseKey failed")
+			return errors.New(E_INTERNAL_ERROR)
+		}
+		changed[key.String()] = key
+	}
+	/* the targets of the added references should exist, the targets of the removed strong references and the
+	inserted rows of non-root tables are garbage collection candidates */
+	targets := map[rowRef]bool{}
+	candidates := map[rowRef]bool{}
+	for keyString, key := range changed {
+		tableSchema := databaseSchema.Tables[key.TableName]
+		oldRow, err := r.storedRow(key.TableName, keyString)
+		if err != nil {
+			txn.log.Error(err, "failed to unmarshal stored row", "key", key.ShortString())
+			return validationError(err)
+		}
+		newRow, ok := txn.cache.Table(dbname, key.TableName)[key.UUID]
+		if !ok {
+			newRow = nil
+			r.missing[rowRef{table: key.TableName, uuid: key.UUID}] = true
+			if oldRow != nil {
+				r.deleted[key.TableName] = true
+			}
+		}
+		oldRefs, oldStrongRefs := countRefs(&tableSchema, oldRow)
+		newRefs, newStrongRefs := countRefs(&tableSchema, newRow)
+		for ref, n := range newRefs {
+			if oldRefs[ref] < n {
+				targets[ref] = true
+			}
+		}
+		for ref, n := range oldStrongRefs {
+			if newStrongRefs[ref] < n && !isRootTable(databaseSchema, ref.table) {
+				candidates[ref] = true
+			}
+		}
+		if oldRow == nil && newRow != nil && !isRootTable(databaseSchema, key.TableName) {
+			candidates[rowRef{table: key.TableName, uuid: key.UUID}] = true
+		}
+	}
+	if err := r.fetch(sortedRowRefs(targets), nil); err != nil {
+		return err
+	}
+	if err := r.collectGarbage(candidates); err != nil {
+		return err
+	}
+	/* the rows that refer to the deleted rows */
+	if err := r.fetch(nil, referrerTables(r.referrers, r.deleted)); err != nil {
+		return err
+	}
+	rows := r.checkedRows()
+	if err := r.removeWeakRefs(rows); err != nil {
+		return err
+	}
+	return r.checkStrongRefs(rows)
+}
+
+// checkedRows returns the rows whose references may refer to missing rows: the rows written by the transaction, and
+// the rows of the tables that refer to the tables of the deleted rows
+func (r *txnRefs) checkedRows() []rowRef {
+	dbname := r.txn.request.DBName
+	rows := map[rowRef]bool{}
+	for table, uuids := range r.txn.eventRows(mvccpb.PUT) {
+		tableCache := r.txn.cache.Table(dbname, table)
+		for uuid := range uuids {
+			if _, ok := tableCache[uuid]; ok {
+				rows[rowRef{table: table, uuid: uuid}] = true
+			}
+		}
+	}
+	for _, table := range referrerTables(r.referrers, r.deleted) {
+		for uuid := range r.txn.cache.Table(dbname, table) {
+			rows[rowRef{table: table, uuid: uuid}] = true
+		}
+	}
+	return sortedRowRefs(rows)
+}
+
+// collectGarbage deletes the candidates that are not referenced by strong references, the candidates are the rows of
+// non-root tables whose strong references count dropped in the transaction. The rows that are referred by the deleted
+// rows are the candidates of the next round.
+func (r *txnRefs) collectGarbage(candidates map[rowRef]bool) error {
+	txn := r.txn
+	dbname := txn.request.DBName
+	for len(candidates) > 0 {
+		tables := map[string]bool{}
+		for candidate := range candidates {
+			tables[candidate.table] = true
+		}
+		sorted := sortedRowRefs(candidates)
+		referrers := referrerTables(r.strongReferrers, tables)
+		if err := r.fetch(sorted, referrers); err != nil {
+			return err
+		}
+		refCount := map[rowRef]int{}
+		for _, table := range referrers {
+			tableSchema := r.schema.Tables[table]
+			for _, row := range txn.cache.Table(dbname, table) {
+				_, strongRefs := countRefs(&tableSchema, row)
+				for ref, n := range strongRefs {
+					if candidates[ref] {
+						refCount[ref] += n
+					}
+				}
+			}
+		}
+		next := map[rowRef]bool{}
+		for _, candidate := range sorted {
+			tableCache := txn.cache.Table(dbname, candidate.table)
+			row, ok := tableCache[candidate.uuid]
+			if !ok || refCount[candidate] > 0 {
+				continue
+			}
+			txn.log.V(5).Info("garbage collecting unreferenced row", "table", candidate.table, "uuid", candidate.uuid)
+			key := common.NewDataKey(dbname, candidate.table, candidate.uuid)
+			if err := etcdDeleteRow(txn, &key); err != nil {
+				return err
+			}
+			delete(tableCache, candidate.uuid)
+			r.missing[candidate] = true
+			r.deleted[candidate.table] = true
+			/* deleted rows may release references to other rows */
+			tableSchema := r.schema.Tables[candidate.table]
+			_, strongRefs := countRefs(&tableSchema, row)
+			for ref := range strongRefs {
+				if !isRootTable(r.schema, ref.table) {
+					next[ref] = true
+				}
+			}
+		}
+		candidates = next
+	}
+	return nil
+}
+
+// removeWeakRefs removes the weak references of the rows to rows that don't exist
+func (r *txnRefs) removeWeakRefs(rows []rowRef) error {
+	txn := r.txn
+	dbname := txn.request.DBName
+	exists := func(ref *columnRef, value interface{}) bool {
+		if ref == nil || ref.strong {
+			return true
+		}
+		uuid, ok := refUUID(value)
+		if !ok {
+			return true
+		}
+		return !r.missing[rowRef{table: ref.table, uuid: uuid}]
+	}
+	for _, checked := range rows {
+		table, uuid := checked.table, checked.uuid
+		tableSchema := r.schema.Tables[table]
+		row := txn.cache.Table(dbname, table)[uuid]
+		var newRow map[string]interface{}
+		for _, column := range sortedColumns(&tableSchema) {
+			columnSchema := tableSchema.Columns[column]
+			keyRef, valueRef := columnRefs(columnSchema)
+			if (keyRef == nil || keyRef.strong) && (valueRef == nil || valueRef.strong) {
+				continue
+			}
+			var newValue interface{}
+			size := 0
+			switch value := (*row)[column].(type) {
+			case libovsdb.OvsSet:
+				newSet := libovsdb.OvsSet{GoSet: []interface{}{}}
+				for _, element := range value.GoSet {
+					if exists(keyRef, element) {
+						newSet.GoSet = append(newSet.GoSet, element)
+					}
+				}
+				if len(newSet.GoSet) == len(value.GoSet) {
+					continue
+				}
+				newValue, size = newSet, len(newSet.GoSet)
+			case libovsdb.OvsMap:
+				newMap := libovsdb.OvsMap{GoMap: map[interface{}]interface{}{}}
+				for key, val := range value.GoMap {
+					if exists(keyRef, key) && exists(valueRef, val) {
+						newMap.GoMap[key] = val
+					}
+				}
+				if len(newMap.GoMap) == len(value.GoMap) {
+					continue
+				}
+				newValue, size = newMap, len(newMap.GoMap)
+			default:
+				if exists(keyRef, value) {
+					continue
+				}
+			}
+			if size < columnSchema.TypeObj.Min {
+				err := newOvsdbError(E_CONSTRAINT_VIOLATION,
+					"Deletion of weak reference(s) from column %q of row %s in table %q leaves the column with fewer than the required %d element(s).",
+					column, uuid, table, columnSchema.TypeObj.Min)
+				txn.log.Error(err, "weak reference removal", "details", errorDetails(err))
+				return err
+			}
+			if newRow == nil {
+				newRow = map[string]interface{}{}
+				for k, v := range *row {
+					newRow[k] = v
+				}
+			}
+			newRow[column] = newValue
+		}
+		if newRow == nil {
+			continue
+		}
+		txn.log.V(5).Info("removing weak references", "table", table, "uuid", uuid)
+		key := common.NewDataKey(dbname, table, uuid)
+		if err := etcdModifyRow(txn, &key, &newRow); err != nil {
+			return err
+		}
+		*row = newRow
+	}
+	return nil
+}
+
+// checkStrongRefs verifies that the rows written by the transaction don't refer to nonexistent rows, and that the rows
+// deleted by the transaction are not referenced by other rows
+func (r *txnRefs) checkStrongRefs(rows []rowRef) error {
+	txn := r.txn
+	dbname := txn.request.DBName
+	written := txn.eventRows(mvccpb.PUT)
+	deleted := txn.eventRows(mvccpb.DELETE)
+	for _, row := range rows {
+		table, uuid := row.table, row.uuid
+		tableSchema := r.schema.Tables[table]
+		err := forEachRef(&tableSchema, txn.cache.Table(dbname, table)[uuid], func(column string, ref *columnRef, refUUID string) error {
+			if !ref.strong || !r.missing[rowRef{table: ref.table, uuid: refUUID}] {
+				return nil
+			}
+			if written[table][uuid] {
+				return newOvsdbError(E_INTEGRITY_VIOLATION,
+					"Table %s column %s row %s references nonexistent row %s in table %s.",
+					table, column, uuid, refUUID, ref.table)
+			}
+			if deleted[ref.table][refUUID] {
+				return newOvsdbError(E_INTEGRITY_VIOLATION,
+					"Cannot delete %s row %s because of remaining reference from table %s column %s row %s.",
+					ref.table, refUUID, table, column, uuid)
+			}
+			return nil
+		})
+		if err != nil {
+			txn.log.Error(err, "referential integrity violation", "details", errorDetails(err))
+			return err
+		}
+	}
+	return nil
+}
+
+/* insert */
+func preInsert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	var err error
+	if err = etcdGetConstrainedTable(txn, *ovsOp.Table); err != nil {
+		return err
+	}
+	if ovsOp.UUID != nil {
+		if err = ovsOp.UUID.ValidateUUID(); err != nil {
+			err = newOvsdbError(E_SYNTAX_ERROR, "bad uuid %q", ovsOp.UUID.GoUUID)
+			txn.log.Error(err, "wrong formatted uuid", "uuid", ovsOp.UUID.GoUUID)
+			return err
+		}
+		/* fetch the row, to detect a duplicate uuid */
+		key := common.NewDataKey(txn.request.DBName, *ovsOp.Table, ovsOp.UUID.GoUUID)
+		etcdGetData(txn, &key)
+	}
+	if ovsOp.UUIDName == nil {
+		return nil
+	}
+
+	if ovsOp.UUIDName != nil {
+		uuid := common.GenerateUUID()
+		if ovsOp.UUID != nil {
+			uuid = ovsOp.UUID.GoUUID
+		}
+		if _, ok := txn.mapUUID[*ovsOp.UUIDName]; ok {
+			err = errors.New(E_DUP_UUIDNAME)
+			txn.log.Error(err, "duplicate uuid-name", "uuid-name", *ovsOp.UUIDName)
+			return err
+		}
+		txn.mapUUID.Set(txn, *ovsOp.UUIDName, uuid)
+	}
+
+	key := common.NewTableKey(txn.request.DBName, *ovsOp.Table)
 	etcdGetData(txn, &key)
 	return nil
 }
@@ -1750,17 +3059,15 @@ func doInsert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 		}
 	}
 
-	for uuid := range txn.cache.Table(txn.request.DBName, *ovsOp.Table) {
-		if ovsOp.UUID != nil && uuid == ovsOp.UUID.GoUUID {
-			err = errors.New(E_DUP_UUID)
-			txn.log.Error(err, "duplicate uuid", "uuid", *ovsOp.UUID)
-			return err
-		}
+	key := common.NewDataKey(txn.request.DBName, *ovsOp.Table, uuid)
+	if ovsOp.UUID != nil && txn.isDupUUID(&key) {
+		err = newOvsdbError(E_DUP_UUID, "This UUID would duplicate a UUID already present within the table or deleted within the same transaction.")
+		txn.log.Error(err, "duplicate uuid", "uuid", uuid)
+		return err
 	}
 
 	ovsResult.InitUUID(uuid)
 
-	key := common.NewDataKey(txn.request.DBName, *ovsOp.Table, uuid)
 	row := txn.cache.Row(key)
 	*row = *ovsOp.Row
 	txn.schemas.Default(txn.request.DBName, *ovsOp.Table, row)
@@ -1768,7 +3075,6 @@ func doInsert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 
 	err = txn.RowPrepare(tableSchema, txn.mapUUID, ovsOp.Row)
 	if err != nil {
-		err = errors.New(E_CONSTRAINT_VIOLATION)
 		txn.log.Error(err, "failed to prepare row", "row", row)
 		return err
 	}
@@ -1776,11 +3082,79 @@ func doInsert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 	return etcdCreateRow(txn, &key, row)
 }
 
+// isDupUUID returns true if the row exists, or if it is modified or deleted by the transaction
+func (txn *Transaction) isDupUUID(key *common.Key) bool {
+	if _, ok := txn.cache.Table(key.DBName, key.TableName)[key.UUID]; ok {
+		return true
+	}
+	for _, ev := range txn.etcd.Events {
+		if ev == nil {
+			continue
+		}
+		if etcdEventKey(ev) == key.String() {
+			return true
+		}
+	}
+	return false
+}
+
 /* select */
 func preSelect(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	if ovsOp.Revision != nil {
+		/* the rows at the revision are fetched by doSelect */
+		if *ovsOp.Revision < 0 {
+			err := newOvsdbError(E_CONSTRAINT_VIOLATION, "The revision %d is negative.", *ovsOp.Revision)
+			txn.log.Error(err, "wrong revision", "revision", *ovsOp.Revision)
+			return err
+		}
+		return nil
+	}
 	return etcdGetByWhere(txn, ovsOp, ovsResult)
 }
 
+// etcdGetAtRevision returns the rows of the table at the revision, 0 stands for the revision of the transaction. The
+// rows are not kept in the cache of the transaction, as they may differ from the current rows.
+func etcdGetAtRevision(txn *Transaction, ovsOp *libovsdb.Operation, revision int64) (TableCache, int64, error) {
+	if revision == 0 {
+		revision = txn.revision
+	}
+	tableSchema, err := txn.schemas.LookupTable(txn.request.DBName, *ovsOp.Table)
+	if err != nil {
+		return nil, 0, errors.New(E_INTERNAL_ERROR)
+	}
+	uuid, err := txn.doesWhereContainCondTypeUUID(tableSchema, txn.mapUUID, ovsOp.Where)
+	if err != nil {
+		return nil, 0, err
+	}
+	key := common.NewDataKey(txn.request.DBName, *ovsOp.Table, uuid)
+	res, err := txn.etcd.Cli.Get(txn.etcd.Ctx, key.String(), clientv3.WithPrefix(), clientv3.WithRev(revision))
+	switch {
+	case err == rpctypes.ErrCompacted:
+		err = newOvsdbError(E_COMPACTED, "The revision %d was compacted, its data is not available anymore.", revision)
+		txn.log.Error(err, "select at compacted revision", "revision", revision)
+		return nil, 0, err
+	case err == rpctypes.ErrFutureRev:
+		err = newOvsdbError(E_CONSTRAINT_VIOLATION, "The revision %d is greater than the current revision.", revision)
+		txn.log.Error(err, "select at future revision", "revision", revision)
+		return nil, 0, err
+	case err != nil && txn.etcd.Ctx.Err() != nil:
+		txn.log.Error(err, "select at revision", "revision", revision)
+		return nil, 0, errors.New(E_CANCELED)
+	case err != nil:
+		txn.log.Error(err, "select at revision", "revision", revision)
+		return nil, 0, errors.New(E_IO_ERROR)
+	}
+	cache := Cache{}
+	if err = cache.GetFromEtcdKV(res.Kvs); err != nil {
+		txn.log.Error(err, "failed to parse rows", "revision", revision)
+		return nil, 0, errors.New(E_INTERNAL_ERROR)
+	}
+	if err = cache.Unmarshal(txn, txn.schemas); err != nil {
+		return nil, 0, validationError(err)
+	}
+	return cache.Table(txn.request.DBName, *ovsOp.Table), revision, nil
+}
+
 func doSelect(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
 	ovsResult.InitRows()
 	tableSchema, err := txn.schemas.LookupTable(txn.request.DBName, *ovsOp.Table)
@@ -1788,7 +3162,15 @@ func doSelect(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 		return errors.New(E_INTERNAL_ERROR)
 	}
 
-	for _, row := range txn.cache.Table(txn.request.DBName, *ovsOp.Table) {
+	rows := txn.cache.Table(txn.request.DBName, *ovsOp.Table)
+	if ovsOp.Revision != nil {
+		var revision int64
+		if rows, revision, err = etcdGetAtRevision(txn, ovsOp, *ovsOp.Revision); err != nil {
+			return err
+		}
+		ovsResult.Revision = &revision
+	}
+	for _, row := range rows {
 		ok, err := txn.isRowSelectedByWhere(tableSchema, txn.mapUUID, row, ovsOp.Where)
 		if err != nil {
 			txn.log.Error(err, "failed to select row by where", "row", row, "where", ovsOp.Where)
@@ -1809,6 +3191,9 @@ func doSelect(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 
 /* update */
 func preUpdate(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	if err := etcdGetConstrainedTable(txn, *ovsOp.Table); err != nil {
+		return err
+	}
 	return etcdGetByWhere(txn, ovsOp, ovsResult)
 }
 
@@ -1849,6 +3234,9 @@ func doUpdate(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 
 /* mutate */
 func preMutate(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	if err := etcdGetConstrainedTable(txn, *ovsOp.Table); err != nil {
+		return err
+	}
 	return etcdGetByWhere(txn, ovsOp, ovsResult)
 }
 
@@ -1902,6 +3290,8 @@ func doDelete(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.O
 		}
 		key := common.NewDataKey(txn.request.DBName, *ovsOp.Table, uuid)
 		etcdDeleteRow(txn, &key)
+		/* the following operations and commit time checks should not see the deleted row */
+		delete(txn.cache.Table(txn.request.DBName, *ovsOp.Table), uuid)
 		ovsResult.IncrementCount()
 	}
 	return nil
@@ -1915,8 +3305,10 @@ func preWait(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.Op
 		txn.log.Error(err, "missing timeout parameter")
 		return err
 	}
-	if *ovsOp.Timeout != 0 {
-		txn.log.Info("ignoring non-zero wait timeout", "timeout", *ovsOp.Timeout)
+	if *ovsOp.Timeout < 0 {
+		err = errors.New(E_CONSTRAINT_VIOLATION)
+		txn.log.Error(err, "negative timeout parameter", "timeout", *ovsOp.Timeout)
+		return err
 	}
 	return etcdGetByWhere(txn, ovsOp, ovsResult)
 }
@@ -2000,9 +3392,7 @@ func doWait(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.Ope
 				if equal {
 					return nil
 				}
-				err = errors.New(E_TIMEOUT)
-				log.Error(err, "timed out")
-				return err
+				return txn.waitTimedOut(ovsOp)
 			}
 		}
 	}
@@ -2011,7 +3401,18 @@ func doWait(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.Ope
 		return nil
 	}
 
-	err = errors.New(E_TIMEOUT)
+	return txn.waitTimedOut(ovsOp)
+}
+
+// waitTimedOut returns the error of a wait operation whose condition is not satisfied. If the timeout of the operation
+// didn't expire yet, the returned error blocks the transaction until the table is modified.
+func (txn *Transaction) waitTimedOut(ovsOp *libovsdb.Operation) error {
+	deadline := txn.startTime.Add(time.Duration(*ovsOp.Timeout) * time.Millisecond)
+	if time.Now().Before(deadline) {
+		txn.log.V(5).Info("wait condition is not satisfied", "table", *ovsOp.Table, "deadline", deadline)
+		return &waitBlocked{table: *ovsOp.Table, deadline: deadline}
+	}
+	err := errors.New(E_TIMEOUT)
 	txn.log.Error(err, "timed out")
 	return err
 }
@@ -2024,18 +3425,42 @@ func preCommit(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.
 		txn.log.Error(err, "missing durable parameter")
 		return err
 	}
-	if *ovsOp.Durable {
-		err = errors.New(E_NOT_SUPPORTED)
-		txn.log.Error(err, "do not support durable == true")
-		return err
-	}
 	return nil
 }
 
 func doCommit(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	if *ovsOp.Durable {
+		txn.durable = true
+	}
 	return nil
 }
 
+// confirmDurable returns true when the transaction committed at the given revision is applied by a quorum of the etcd
+// cluster. etcd replies to a write only after it is committed by the raft quorum, the linearizable read confirms in
+// addition that the cluster serves the revision, e.g. it was not lost by a leader change. The transaction was already
+// committed, so the read is not canceled with the transaction, and it is retried until DURABLE_CONFIRM_TIMEOUT.
+func (txn *Transaction) confirmDurable(revision int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), DURABLE_CONFIRM_TIMEOUT)
+	defer cancel()
+	key := common.NewTableKey(txn.request.DBName, "")
+	for {
+		res, err := txn.etcd.Cli.Get(ctx, key.DBKeyString(), clientv3.WithCountOnly())
+		if err == nil && res.Header.Revision >= revision {
+			txn.log.V(5).Info("durable commit", "revision", revision)
+			return true
+		}
+		if err == nil {
+			err = fmt.Errorf("the cluster serves revision %d", res.Header.Revision)
+		}
+		select {
+		case <-ctx.Done():
+			txn.log.Error(err, "the durability of the committed transaction was not confirmed", "revision", revision)
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
 /* abort */
 func preAbort(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
 	return errors.New(E_ABORTED)
@@ -2054,6 +3479,7 @@ func doComment(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.
 	timestamp := time.Now().Format(time.RFC3339)
 	key := common.NewCommentKey(timestamp)
 	comment := *ovsOp.Comment
+	txn.comments = append(txn.comments, comment)
 	etcdOp := clientv3.OpPut(key.String(), comment)
 	txn.etcd.Then = append(txn.etcd.Then, etcdOp)
 	txn.etcd.Events = append(txn.etcd.Events, nil) /* so that events are aligned with then operations */
@@ -2063,10 +3489,61 @@ func doComment(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.
 }
 
 /* assert */
+type assertion struct {
+	lockID string
+	result *libovsdb.OperationResult
+}
+
+// lockLost checks whether the etcd transaction failed because one of the asserted locks is not owned anymore, if so
+// it sets the error of the assert operation. The ownership of every asserted lock is checked by a nested transaction
+// in the else branch of the etcd transaction, see doAssert.
+func (txn *Transaction) lockLost(res *clientv3.TxnResponse) bool {
+	for i, a := range txn.asserts {
+		if i >= len(res.Responses) {
+			break
+		}
+		nested := res.Responses[i].GetResponseTxn()
+		if nested == nil || nested.Succeeded {
+			continue
+		}
+		err := errors.New(E_NOT_OWNER)
+		txn.log.Error(err, "the lock was lost before the commit", "lock", a.lockID)
+		errStr := err.Error()
+		a.result.SetError(errStr)
+		txn.response.Error = &errStr
+		return true
+	}
+	return false
+}
+
 func preAssert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	var err error
+	if ovsOp.Lock == nil {
+		err = errors.New(E_CONSTRAINT_VIOLATION)
+		txn.log.Error(err, "missing lock parameter")
+		return err
+	}
 	return nil
 }
 
 func doAssert(txn *Transaction, ovsOp *libovsdb.Operation, ovsResult *libovsdb.OperationResult) error {
+	var err error
+	myLock, ok := txn.locks[*ovsOp.Lock]
+	if !ok {
+		err = errors.New(E_NOT_OWNER)
+		txn.log.Error(err, "the lock was not requested", "lock", *ovsOp.Lock)
+		return err
+	}
+	cmps, ok := myLock.isOwner()
+	if !ok {
+		err = errors.New(E_NOT_OWNER)
+		txn.log.Error(err, "the lock is not acquired", "lock", *ovsOp.Lock)
+		return err
+	}
+	/* the lock may be lost (e.g. stolen) until the commit, so the commit is conditioned on its ownership */
+	/* the comparisons of the asserts precede the others, so they are not nested (see Etcd.Commit) */
+	txn.etcd.If = append(append([]clientv3.Cmp{}, cmps...), txn.etcd.If...)
+	txn.etcd.Else = append(txn.etcd.Else, clientv3.OpTxn(cmps, nil, nil))
+	txn.asserts = append(txn.asserts, assertion{lockID: *ovsOp.Lock, result: ovsResult})
 	return nil
 }
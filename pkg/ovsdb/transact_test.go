@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
 	klog "k8s.io/klog/v2"
 	klogr "k8s.io/klog/v2/klogr"
 
@@ -208,6 +212,148 @@ var testSchemaUUID *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
 	},
 }
 
+var testSchemaIndex *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
+	Name:    "index",
+	Version: "0.0.0",
+	Tables: map[string]libovsdb.TableSchema{
+		"table1": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"name": {
+					Type: libovsdb.TypeString,
+				},
+				"number": {
+					Type: libovsdb.TypeInteger,
+				},
+			},
+			Indexes: [][]string{{"name"}},
+		},
+	},
+}
+
+var testSchemaMaxRows *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
+	Name:    "maxrows",
+	Version: "0.0.0",
+	Tables: map[string]libovsdb.TableSchema{
+		"table1": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"name": {
+					Type: libovsdb.TypeString,
+				},
+			},
+			MaxRows: 1,
+		},
+	},
+}
+
+var (
+	testBoundMinInteger = 0
+	testBoundMaxInteger = 10
+	testBoundMaxLength  = 3
+)
+
+var testSchemaBounds *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
+	Name:    "bounds",
+	Version: "0.0.0",
+	Tables: map[string]libovsdb.TableSchema{
+		"table1": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"integer": {
+					Type: libovsdb.TypeInteger,
+					TypeObj: &libovsdb.ColumnType{
+						Key: &libovsdb.BaseType{
+							Type:       libovsdb.TypeInteger,
+							MinInteger: &testBoundMinInteger,
+							MaxInteger: &testBoundMaxInteger,
+						},
+						Min: 1,
+						Max: 1,
+					},
+				},
+				"string": {
+					Type: libovsdb.TypeString,
+					TypeObj: &libovsdb.ColumnType{
+						Key: &libovsdb.BaseType{
+							Type:      libovsdb.TypeString,
+							MaxLength: &testBoundMaxLength,
+						},
+						Min: 1,
+						Max: 1,
+					},
+				},
+				"counter": {
+					Type: libovsdb.TypeInteger,
+				},
+				"real": {
+					Type: libovsdb.TypeReal,
+				},
+			},
+		},
+	},
+}
+
+var testSchemaRefs *libovsdb.DatabaseSchema = &libovsdb.DatabaseSchema{
+	Name:    "refs",
+	Version: "0.0.0",
+	Tables: map[string]libovsdb.TableSchema{
+		"parent": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"children": {
+					Type: libovsdb.TypeSet,
+					TypeObj: &libovsdb.ColumnType{
+						Key: &libovsdb.BaseType{
+							Type:     libovsdb.TypeUUID,
+							RefTable: "child",
+							RefType:  libovsdb.Strong,
+						},
+						Min: 0,
+						Max: libovsdb.Unlimited,
+					},
+				},
+				"owner": {
+					Type: libovsdb.TypeSet,
+					TypeObj: &libovsdb.ColumnType{
+						Key: &libovsdb.BaseType{
+							Type:     libovsdb.TypeUUID,
+							RefTable: "other",
+							RefType:  libovsdb.Strong,
+						},
+						Min: 0,
+						Max: 1,
+					},
+				},
+				"peers": {
+					Type: libovsdb.TypeSet,
+					TypeObj: &libovsdb.ColumnType{
+						Key: &libovsdb.BaseType{
+							Type:     libovsdb.TypeUUID,
+							RefTable: "other",
+							RefType:  libovsdb.Weak,
+						},
+						Min: 0,
+						Max: libovsdb.Unlimited,
+					},
+				},
+			},
+			IsRoot: true,
+		},
+		"child": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"name": {
+					Type: libovsdb.TypeString,
+				},
+			},
+		},
+		"other": {
+			Columns: map[string]*libovsdb.ColumnSchema{
+				"name": {
+					Type: libovsdb.TypeString,
+				},
+			},
+			IsRoot: true,
+		},
+	},
+}
+
 func testEtcdNewCli() (*clientv3.Client, error) {
 	endpoints := []string{"http://127.0.0.1:2379"}
 	return NewEtcdClient(endpoints)
@@ -249,12 +395,21 @@ func testEtcdDump(t *testing.T, dbname, table string) map[string]interface{} {
 	return *dump
 }
 
+func testEtcdCount(t *testing.T, dbname, table string) int64 {
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	ctx := context.TODO()
+	key := common.NewTableKey(dbname, table)
+	res, err := cli.Get(ctx, key.TableKeyString(), clientv3.WithPrefix(), clientv3.WithCountOnly())
+	assert.Nil(t, err)
+	return res.Count
+}
+
 func testEtcdPut(t *testing.T, dbname, table string, row map[string]interface{}) {
 	cli, err := testEtcdNewCli()
 	assert.Nil(t, err)
 	ctx := context.TODO()
 	key := common.GenerateDataKey(dbname, table)
-	setRowUUID(&row, key.UUID)
 	val, err := makeValue(&row)
 	assert.Nil(t, err)
 	_, err = cli.Put(ctx, key.String(), val)
@@ -265,7 +420,13 @@ func testTransact(t *testing.T, req *libovsdb.Transact) (*libovsdb.TransactRespo
 	cli, err := testEtcdNewCli()
 	assert.Nil(t, err)
 	defer cli.Close()
-	txn := NewTransaction(cli, klogr.New(), req)
+	txn := testNewTransaction(cli, req)
+	txn.Commit()
+	return &txn.response, txn
+}
+
+func testNewTransaction(cli *clientv3.Client, req *libovsdb.Transact) *Transaction {
+	txn := NewTransaction(context.Background(), cli, klogr.New(), req)
 	txn.AddSchema(testSchemaSimple)
 	txn.AddSchema(testSchemaAtomic)
 	txn.AddSchema(testSchemaMutable)
@@ -273,8 +434,11 @@ func testTransact(t *testing.T, req *libovsdb.Transact) (*libovsdb.TransactRespo
 	txn.AddSchema(testSchemaSet)
 	txn.AddSchema(testSchemaMap)
 	txn.AddSchema(testSchemaUUID)
-	txn.Commit()
-	return &txn.response, txn
+	txn.AddSchema(testSchemaIndex)
+	txn.AddSchema(testSchemaRefs)
+	txn.AddSchema(testSchemaMaxRows)
+	txn.AddSchema(testSchemaBounds)
+	return txn
 }
 
 func testTransactDump(t *testing.T, txn *Transaction, dbname, table string) map[string]interface{} {
@@ -353,22 +517,79 @@ func TestTransactInsertSimpleScale100(t *testing.T) {
 	testTransactInsertSimpleScale(t, 100)
 }
 
-/*
-XXX: If run with default setting then it will fail with message:
-XXX:
-XXX:   etcdserver: too many operations in txn request
-XXX:
-XXX: To enable the test to pass:
-XXX: 1. use etcd version 3.4.x and above
-XXX: 2. configure in /etc/default/etcd:
-XXX:
-XXX:   ETCD_MAX_TXN_OPS=100000
-XXX:   ETCD_MAX_REQUEST_BYTES=100000000
-XXX:
 func TestTransactInsertSimpleScale1000(t *testing.T) {
 	testTransactInsertSimpleScale(t, 1000)
+	/* the oversized transaction is committed at a single revision */
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	key := common.NewTableKey("simple", "table1")
+	res, err := cli.Get(context.TODO(), key.TableKeyString(), clientv3.WithPrefix())
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		assert.Equal(t, res.Kvs[0].ModRevision, kv.ModRevision)
+	}
+}
+
+func testNestedOps(t *testing.T, ops []clientv3.Op, limit int) int {
+	assert.True(t, len(ops) <= limit)
+	leaves := 0
+	for _, op := range ops {
+		if op.IsTxn() {
+			_, then, _ := op.Txn()
+			leaves += testNestedOps(t, then, limit-len(ops))
+		} else {
+			leaves++
+		}
+	}
+	return leaves
+}
+
+func TestTransactNestOps(t *testing.T) {
+	for _, n := range []int{1, ETCD_MAX_TXN_OPS, ETCD_MAX_TXN_OPS + 1, 1000, 100000} {
+		ops := make([]clientv3.Op, n)
+		for i := range ops {
+			ops[i] = clientv3.OpPut(fmt.Sprintf("key%d", i), "")
+		}
+		nested := nestOps(ops, 0, ETCD_MAX_TXN_OPS)
+		assert.Equal(t, n, testNestedOps(t, nested, ETCD_MAX_TXN_OPS))
+	}
+}
+
+func TestTransactDeleteSimpleScale(t *testing.T) {
+	table := "table1"
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	n := 300
+	for i := 0; i < n; i++ {
+		testEtcdPut(t, "simple", "table1", map[string]interface{}{
+			"key1": "val1",
+		})
+	}
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	/* too many rows to compare, the table is compared as a whole */
+	assert.Equal(t, 2, len(txn.etcd.If))
+	assert.Equal(t, n, *resp.Result[0].Count)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	key := common.NewDeletionKey("simple", "table1")
+	res, err := cli.Get(context.TODO(), key.String())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Kvs))
 }
-*/
 
 func TestTransactInsertSimpleWithUUID(t *testing.T) {
 	table := "table1"
@@ -395,6 +616,35 @@ func TestTransactInsertSimpleWithUUID(t *testing.T) {
 	assert.Equal(t, int(0), dump["key2"])
 }
 
+func TestTransactInsertWithUUIDAfterComment(t *testing.T) {
+	table := "table1"
+	comment := "comment1"
+	row := map[string]interface{}{
+		"key1": "val1",
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:      OP_COMMENT,
+				Comment: &comment,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+				UUID:  &libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"},
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	dump := testTransactDump(t, txn, "simple", "table1")
+	assert.Equal(t, "val1", dump["key1"])
+}
+
 func TestTransactInsertSimpleWithUUIDName(t *testing.T) {
 	table := "table1"
 	row := map[string]interface{}{
@@ -450,98 +700,235 @@ func TestTransactInsertSimpleWithUUIDNameDupError(t *testing.T) {
 	assert.NotEqual(t, "", resp.Error)
 }
 
-func TestTransactAtomicInsertNamedUUID(t *testing.T) {
+func TestTransactInsertUUIDDupError(t *testing.T) {
 	table := "table1"
-	uuidName1 := libovsdb.UUID{GoUUID: "myuuid1"}
-	uuid1 := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
-	uuid1buf, err := json.Marshal(uuid1)
-	assert.Nil(t, err)
-	uuid1array := []interface{}{}
-	err = json.Unmarshal(uuid1buf, &uuid1array)
-	assert.Nil(t, err)
-
-	row1 := map[string]interface{}{
-		"string": "val1",
-	}
-	row2 := map[string]interface{}{
-		"uuid": &uuidName1,
+	row := map[string]interface{}{
+		"key1": "val1",
 	}
-
-	req1 := &libovsdb.Transact{
-		DBName: "atomic",
+	req := &libovsdb.Transact{
+		DBName: "simple",
 		Operations: []libovsdb.Operation{
 			{
-				Op:       OP_INSERT,
-				Table:    &table,
-				Row:      &row1,
-				UUID:     &uuid1,
-				UUIDName: &uuidName1.GoUUID,
-			},
-			{
-				Op:    OP_UPDATE,
+				Op:    OP_INSERT,
 				Table: &table,
-				Row:   &row2,
+				Row:   &row,
+				UUID:  &libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"},
 			},
 		},
 	}
-
 	common.SetPrefix("ovsdb/nb")
 	testEtcdCleanup(t)
-
-	resp, _ := testTransact(t, req1)
+	resp, _ := testTransact(t, req)
 	assert.Nil(t, resp.Error)
 
-	dump := testEtcdDump(t, "atomic", "table1")
-	assert.Equal(t, []interface{}{"uuid", uuid1.GoUUID}, dump["uuid"])
+	/* the row exists */
+	resp, _ = testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_DUP_UUID, *resp.Result[0].Error)
+	assert.Equal(t, int64(1), testEtcdCount(t, "simple", "table1"))
 }
 
-func TestTransactAtomicInsertUUID(t *testing.T) {
+func TestTransactInsertUUIDDeletedDupError(t *testing.T) {
 	table := "table1"
-	uuid1 := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
-	uuid1buf, err := json.Marshal(uuid1)
-	assert.Nil(t, err)
-	uuid1array := []interface{}{}
-	err = json.Unmarshal(uuid1buf, &uuid1array)
-	assert.Nil(t, err)
-
-	row1 := map[string]interface{}{
-		"string": "val1",
-	}
-
-	row2 := map[string]interface{}{
-		"string": "val2",
+	row := map[string]interface{}{
+		"key1": "val1",
 	}
-
-	where2 := []interface{}{
-		[]interface{}{"_uuid", "==", uuid1array},
+	uuid := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
+	where := []interface{}{
+		[]interface{}{COL_UUID, FN_EQ, []interface{}{"uuid", uuid.GoUUID}},
 	}
-
-	req1 := &libovsdb.Transact{
-		DBName: "atomic",
+	req := &libovsdb.Transact{
+		DBName: "simple",
 		Operations: []libovsdb.Operation{
 			{
 				Op:    OP_INSERT,
 				Table: &table,
-				Row:   &row1,
-				UUID:  &uuid1,
+				Row:   &row,
+				UUID:  &uuid,
 			},
 			{
-				Op:    OP_UPDATE,
+				Op:    OP_DELETE,
 				Table: &table,
-				Row:   &row2,
-				Where: &where2,
+				Where: &where,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+				UUID:  &uuid,
 			},
 		},
 	}
-
 	common.SetPrefix("ovsdb/nb")
 	testEtcdCleanup(t)
-
-	resp, _ := testTransact(t, req1)
-	assert.Nil(t, resp.Error)
-
-	dump := testEtcdDump(t, "atomic", "table1")
-	assert.Equal(t, []interface{}{"uuid", uuid1.GoUUID}, dump["_uuid"])
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_DUP_UUID, *resp.Result[2].Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+}
+
+func TestTransactInsertUUIDFormatError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"key1": "val1",
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+				UUID:  &libovsdb.UUID{GoUUID: "not-a-uuid"},
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_SYNTAX_ERROR, *resp.Result[0].Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+}
+
+func TestTransactInsertUUIDWithUUIDName(t *testing.T) {
+	table := "table1"
+	uuid := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
+	uuidName := "myuuid"
+	row1 := map[string]interface{}{
+		"string": "val1",
+	}
+	row2 := map[string]interface{}{
+		"uuid": libovsdb.UUID{GoUUID: uuidName},
+	}
+	req := &libovsdb.Transact{
+		DBName: "atomic",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_INSERT,
+				Table:    &table,
+				Row:      &row1,
+				UUID:     &uuid,
+				UUIDName: &uuidName,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row2,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, uuid, *resp.Result[0].UUID)
+
+	dump := testEtcdDump(t, "atomic", "table1")
+	assert.Equal(t, []interface{}{"uuid", uuid.GoUUID}, dump["uuid"])
+}
+
+func TestTransactAtomicInsertNamedUUID(t *testing.T) {
+	table := "table1"
+	uuidName1 := libovsdb.UUID{GoUUID: "myuuid1"}
+	uuid1 := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
+	uuid1buf, err := json.Marshal(uuid1)
+	assert.Nil(t, err)
+	uuid1array := []interface{}{}
+	err = json.Unmarshal(uuid1buf, &uuid1array)
+	assert.Nil(t, err)
+
+	row1 := map[string]interface{}{
+		"string": "val1",
+	}
+	row2 := map[string]interface{}{
+		"uuid": &uuidName1,
+	}
+
+	req1 := &libovsdb.Transact{
+		DBName: "atomic",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_INSERT,
+				Table:    &table,
+				Row:      &row1,
+				UUID:     &uuid1,
+				UUIDName: &uuidName1.GoUUID,
+			},
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row2,
+			},
+		},
+	}
+
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+
+	resp, _ := testTransact(t, req1)
+	assert.Nil(t, resp.Error)
+
+	dump := testEtcdDump(t, "atomic", "table1")
+	assert.Equal(t, []interface{}{"uuid", uuid1.GoUUID}, dump["uuid"])
+}
+
+func TestTransactAtomicInsertUUID(t *testing.T) {
+	table := "table1"
+	uuid1 := libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"}
+	uuid1buf, err := json.Marshal(uuid1)
+	assert.Nil(t, err)
+	uuid1array := []interface{}{}
+	err = json.Unmarshal(uuid1buf, &uuid1array)
+	assert.Nil(t, err)
+
+	row1 := map[string]interface{}{
+		"string": "val1",
+	}
+
+	row2 := map[string]interface{}{
+		"string": "val2",
+	}
+
+	where2 := []interface{}{
+		[]interface{}{"_uuid", "==", uuid1array},
+	}
+
+	req1 := &libovsdb.Transact{
+		DBName: "atomic",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+				UUID:  &uuid1,
+			},
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row2,
+				Where: &where2,
+			},
+		},
+	}
+
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+
+	resp, _ := testTransact(t, req1)
+	assert.Nil(t, resp.Error)
+
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	key := common.NewDataKey("atomic", "table1", uuid1.GoUUID)
+	res, err := cli.Get(context.TODO(), key.String())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Kvs))
+
+	dump := testEtcdDump(t, "atomic", "table1")
+	assert.Equal(t, "val2", dump["string"])
+	assert.Nil(t, dump["_uuid"])
 }
 
 func TestTransactInsertEnumOk(t *testing.T) {
@@ -656,6 +1043,95 @@ func TestTransactSelect(t *testing.T) {
 	assert.Equal(t, int(3), dump["key2"])
 }
 
+func testTransactSelectAt(t *testing.T, revision int64) *libovsdb.TransactResponse {
+	table := "table1"
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_SELECT,
+				Table:    &table,
+				Columns:  &[]string{"key1"},
+				Revision: &revision,
+			},
+		},
+	}
+	resp, _ := testTransact(t, req)
+	return resp
+}
+
+func TestTransactSelectAtRevision(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val1",
+	})
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	res, err := cli.Get(context.TODO(), "ovsdb", clientv3.WithCountOnly())
+	assert.Nil(t, err)
+	revision := res.Header.Revision
+
+	table := "table1"
+	row := map[string]interface{}{
+		"key1": "val2",
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row,
+				Where: &[]interface{}{},
+			},
+		},
+	}
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+
+	resp = testTransactSelectAt(t, revision)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, revision, *resp.Result[0].Revision)
+	assert.Equal(t, 1, len(*resp.Result[0].Rows))
+	assert.Equal(t, "val1", (*resp.Result[0].Rows)[0]["key1"])
+
+	/* the current revision */
+	resp = testTransactSelectAt(t, 0)
+	assert.Nil(t, resp.Error)
+	assert.True(t, *resp.Result[0].Revision > revision)
+	assert.Equal(t, "val2", (*resp.Result[0].Rows)[0]["key1"])
+}
+
+func TestTransactSelectAtRevisionCompactedError(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val1",
+	})
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	res, err := cli.Get(context.TODO(), "ovsdb", clientv3.WithCountOnly())
+	assert.Nil(t, err)
+	revision := res.Header.Revision
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val2",
+	})
+	_, err = cli.Compact(context.TODO(), revision+1)
+	assert.Nil(t, err)
+
+	resp := testTransactSelectAt(t, revision)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_COMPACTED, *resp.Result[0].Error)
+	assert.Nil(t, resp.Result[0].Revision)
+
+	resp = testTransactSelectAt(t, revision+1000)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[0].Error)
+}
+
 func TestTransactUpdateSimple(t *testing.T) {
 	table := "table1"
 	row1 := map[string]interface{}{
@@ -787,6 +1263,56 @@ func TestTransactUpdateWhere(t *testing.T) {
 	assert.Equal(t, "val2", dump["string"])
 }
 
+func TestTransactUpdateWhereVersion(t *testing.T) {
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val1",
+	})
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:      OP_SELECT,
+				Table:   &table,
+				Columns: &[]string{COL_UUID, COL_VERSION},
+			},
+		},
+	}
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 1, len(*resp.Result[0].Rows))
+	version, ok := (*resp.Result[0].Rows)[0][COL_VERSION].(libovsdb.UUID)
+	assert.True(t, ok)
+
+	row := map[string]interface{}{
+		"key1": "val2",
+	}
+	where := []interface{}{
+		[]interface{}{COL_VERSION, FN_EQ, []interface{}{"uuid", version.GoUUID}},
+	}
+	req = &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row,
+				Where: &where,
+			},
+		},
+	}
+	resp, _ = testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 1, *resp.Result[0].Count)
+
+	/* the row was modified, so the version is stale */
+	resp, _ = testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 0, *resp.Result[0].Count)
+}
+
 func TestTransactUpdateMapOk(t *testing.T) {
 	table := "table1"
 	row1 := map[string]interface{}{
@@ -919,13 +1445,60 @@ func TestTransactMutateSimple(t *testing.T) {
 	assert.Equal(t, float64(2), dump["key2"])
 }
 
-func TestTransactMutateMapNamedUUID(t *testing.T) {
-	namedUUID1 := "myuuid1"
-	namedUUID2 := "myuuid2"
-
-	table1 := "table1"
-	table1row1 := map[string]interface{}{}
-
+func TestTransactMutateConcurrent(t *testing.T) {
+	table := "table1"
+	mutations := []interface{}{
+		[]interface{}{
+			"key2",
+			"+=",
+			int(1),
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key2": int(0),
+	})
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	/* concurrent transactions that read and modify the same row must not lose updates */
+	workers := 4
+	count := 5
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				req := &libovsdb.Transact{
+					DBName: "simple",
+					Operations: []libovsdb.Operation{
+						{
+							Op:        OP_MUTATE,
+							Table:     &table,
+							Mutations: &mutations,
+						},
+					},
+				}
+				txn := testNewTransaction(cli, req)
+				_, err := txn.Commit()
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	dump := testEtcdDump(t, "simple", "table1")
+	assert.Equal(t, float64(workers*count), dump["key2"])
+}
+
+func TestTransactMutateMapNamedUUID(t *testing.T) {
+	namedUUID1 := "myuuid1"
+	namedUUID2 := "myuuid2"
+
+	table1 := "table1"
+	table1row1 := map[string]interface{}{}
+
 	table2 := "table2"
 	table2row1 := map[string]interface{}{
 		"map": libovsdb.OvsMap{GoMap: map[interface{}]interface{}{
@@ -1024,82 +1597,675 @@ func TestTransactMutateSet(t *testing.T) {
 			},
 		},
 	}
-	common.SetPrefix("ovsdb/nb")
-	testEtcdCleanup(t)
-	resp, _ := testTransact(t, req)
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	dump := testEtcdDump(t, "set", "table1")
+	expected := []interface{}{
+		"set",
+		[]interface{}{
+			[]interface{}{"uuid", "00000000-0000-0000-0000-000000000001"},
+			[]interface{}{"uuid", "00000000-0000-0000-0000-000000000002"},
+		},
+	}
+	assert.Equal(t, expected, dump["uuid"])
+}
+
+func TestTransactMutateSetMaxError(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{
+		"integer": libovsdb.OvsSet{GoSet: []interface{}{}},
+	}
+	mutations := []interface{}{
+		[]interface{}{
+			"integer",
+			MT_INSERT,
+			libovsdb.OvsSet{GoSet: []interface{}{"a", "b", "c"}},
+		},
+	}
+	req := &libovsdb.Transact{
+		DBName: "set",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+			},
+			{
+				Op:        OP_MUTATE,
+				Table:     &table,
+				Mutations: &mutations,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+	assert.Contains(t, *resp.Result[1].Details, `"integer"`)
+	assert.Contains(t, *resp.Result[1].Details, `"table1"`)
+	assert.Equal(t, int64(0), testEtcdCount(t, "set", "table1"))
+}
+
+func testTransactMutateBounds(t *testing.T, row map[string]interface{}, mutation []interface{}) *libovsdb.TransactResponse {
+	table := "table1"
+	mutations := []interface{}{mutation}
+	req := &libovsdb.Transact{
+		DBName: "bounds",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+			{
+				Op:        OP_MUTATE,
+				Table:     &table,
+				Mutations: &mutations,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	return resp
+}
+
+func TestTransactMutateIntegerBoundsError(t *testing.T) {
+	resp := testTransactMutateBounds(t, map[string]interface{}{"integer": 5}, []interface{}{"integer", MT_SUM, 6})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+	assert.Contains(t, *resp.Result[1].Details, `"integer"`)
+	assert.Contains(t, *resp.Result[1].Details, `"table1"`)
+	assert.Equal(t, int64(0), testEtcdCount(t, "bounds", "table1"))
+}
+
+func TestTransactMutateIntegerBounds(t *testing.T) {
+	resp := testTransactMutateBounds(t, map[string]interface{}{"integer": 5}, []interface{}{"integer", MT_SUM, 5})
+	assert.Nil(t, resp.Error)
+	dump := testEtcdDump(t, "bounds", "table1")
+	assert.Equal(t, float64(10), dump["integer"])
+}
+
+func TestTransactMutateIntegerOverflowError(t *testing.T) {
+	resp := testTransactMutateBounds(t, map[string]interface{}{"counter": maxInt}, []interface{}{"counter", MT_SUM, 1})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_RANGE_ERROR, *resp.Result[1].Error)
+	assert.Contains(t, *resp.Result[1].Details, `"counter"`)
+
+	resp = testTransactMutateBounds(t, map[string]interface{}{"counter": minInt}, []interface{}{"counter", MT_QUOTIENT, -1})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_RANGE_ERROR, *resp.Result[1].Error)
+
+	resp = testTransactMutateBounds(t, map[string]interface{}{"counter": maxInt/2 + 1}, []interface{}{"counter", MT_PRODUCT, 2})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_RANGE_ERROR, *resp.Result[1].Error)
+}
+
+func TestTransactMutateDivisionByZeroError(t *testing.T) {
+	resp := testTransactMutateBounds(t, map[string]interface{}{"counter": 7}, []interface{}{"counter", MT_REMAINDER, 0})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_DOMAIN_ERROR, *resp.Result[1].Error)
+	assert.Contains(t, *resp.Result[1].Details, `"counter"`)
+
+	resp = testTransactMutateBounds(t, map[string]interface{}{"real": 7.0}, []interface{}{"real", MT_QUOTIENT, 0.0})
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_DOMAIN_ERROR, *resp.Result[1].Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "bounds", "table1"))
+}
+
+func TestTransactInsertStringBoundsError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"string": "abcd",
+	}
+	req := &libovsdb.Transact{
+		DBName: "bounds",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[0].Error)
+	assert.Contains(t, *resp.Result[0].Details, `"string"`)
+	assert.Equal(t, int64(0), testEtcdCount(t, "bounds", "table1"))
+}
+
+func TestTransactSelectInvalidDataError(t *testing.T) {
+	table := "table1"
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_SELECT,
+				Table: &table,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key2": "val2",
+	})
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	txn := testNewTransaction(cli, req)
+	_, err = txn.Commit()
+	assert.NotNil(t, err)
+	results := txn.Results(err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *results[1].Error)
+	assert.Contains(t, *results[1].Details, `"key2"`)
+}
+
+func TestTransactMutateUnmutableError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"mutable":   int(1),
+		"unmutable": int(1),
+	}
+	mutations := []interface{}{
+		[]interface{}{
+			"mutable",
+			"+=",
+			int(1),
+		},
+		[]interface{}{
+			"unmutable",
+			"+=",
+			int(1),
+		},
+	}
+	req := &libovsdb.Transact{
+		DBName: "mutable",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+			{
+				Op:        OP_MUTATE,
+				Table:     &table,
+				Mutations: &mutations,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+}
+
+func TestTransactDelete(t *testing.T) {
+	table := "table1"
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val1",
+		"key2": int(2),
+	})
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	dump := testEtcdDump(t, "simple", "table1")
+	_, ok := dump["key1"]
+	assert.False(t, ok)
+}
+
+func TestTransactIndexInsertDupError(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{
+		"name":   "name1",
+		"number": int(1),
+	}
+	row2 := map[string]interface{}{
+		"name":   "name1",
+		"number": int(2),
+	}
+	req := &libovsdb.Transact{
+		DBName: "index",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row2,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 3, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[2].Error)
+	assert.NotNil(t, resp.Result[2].Details)
+	dump := testEtcdDump(t, "index", "table1")
+	assert.Equal(t, 0, len(dump))
+}
+
+func TestTransactIndexInsertExistingDupError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"name":   "name1",
+		"number": int(2),
+	}
+	req := &libovsdb.Transact{
+		DBName: "index",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "index", "table1", map[string]interface{}{
+		"name":   "name1",
+		"number": int(1),
+	})
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+	dump := testEtcdDump(t, "index", "table1")
+	assert.Equal(t, float64(1), dump["number"])
+}
+
+func TestTransactIndexUpdateDupError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"name": "name1",
+	}
+	req := &libovsdb.Transact{
+		DBName: "index",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Where: &[]interface{}{[]interface{}{"name", FN_EQ, "name2"}},
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "index", "table1", map[string]interface{}{
+		"name":   "name1",
+		"number": int(1),
+	})
+	testEtcdPut(t, "index", "table1", map[string]interface{}{
+		"name":   "name2",
+		"number": int(2),
+	})
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+}
+
+func TestTransactIndexDeleteInsert(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"name":   "name1",
+		"number": int(2),
+	}
+	req := &libovsdb.Transact{
+		DBName: "index",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+				Where: &[]interface{}{[]interface{}{"name", FN_EQ, "name1"}},
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "index", "table1", map[string]interface{}{
+		"name":   "name1",
+		"number": int(1),
+	})
+	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	dump := testEtcdDump(t, "index", "table1")
+	assert.Equal(t, float64(2), dump["number"])
+}
+
+func TestTransactMaxRowsInsertError(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"name": "name2",
+	}
+	req := &libovsdb.Transact{
+		DBName: "maxrows",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "maxrows", "table1", map[string]interface{}{
+		"name": "name1",
+	})
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+	assert.NotNil(t, resp.Result[1].Details)
+	assert.Equal(t, int64(1), testEtcdCount(t, "maxrows", "table1"))
+}
+
+func TestTransactMaxRowsDeleteInsert(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"name": "name2",
+	}
+	req := &libovsdb.Transact{
+		DBName: "maxrows",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "maxrows", "table1", map[string]interface{}{
+		"name": "name1",
+	})
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	/* the table prefix and the fetched row */
+	assert.Equal(t, 2, len(txn.etcd.If))
+	dump := testEtcdDump(t, "maxrows", "table1")
+	assert.Equal(t, "name2", dump["name"])
+}
+
+func TestTransactRefsStrongDanglingError(t *testing.T) {
+	table := "parent"
+	row := map[string]interface{}{
+		"children": libovsdb.OvsSet{GoSet: []interface{}{
+			libovsdb.UUID{GoUUID: "00000000-0000-0000-0000-000000000001"},
+		}},
+	}
+	req := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_INTEGRITY_VIOLATION, *resp.Result[1].Error)
+	assert.NotNil(t, resp.Result[1].Details)
+	assert.Equal(t, int64(0), testEtcdCount(t, "refs", "parent"))
+}
+
+func TestTransactRefsGarbageCollection(t *testing.T) {
+	parent := "parent"
+	child := "child"
+	namedUUID := "child1"
+	childRow1 := map[string]interface{}{
+		"name": "child1",
+	}
+	childRow2 := map[string]interface{}{
+		"name": "orphan",
+	}
+	parentRow := map[string]interface{}{
+		"children": libovsdb.OvsSet{GoSet: []interface{}{
+			libovsdb.UUID{GoUUID: namedUUID},
+		}},
+	}
+	req1 := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_INSERT,
+				Table:    &child,
+				Row:      &childRow1,
+				UUIDName: &namedUUID,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &child,
+				Row:   &childRow2,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &parent,
+				Row:   &parentRow,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, txn := testTransact(t, req1)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, int64(1), testEtcdCount(t, "refs", "child"))
+	dump := testEtcdDump(t, "refs", "child")
+	assert.Equal(t, "child1", dump["name"])
+	/* the orphan row was created and deleted in the same transaction */
+	assert.Equal(t, 2, len(txn.etcd.Events))
+
+	req2 := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &parent,
+			},
+		},
+	}
+	resp, txn = testTransact(t, req2)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "refs", "parent"))
+	assert.Equal(t, int64(0), testEtcdCount(t, "refs", "child"))
+	assert.Equal(t, 2, len(txn.etcd.Events))
+}
+
+func TestTransactRefsGarbageCollectionChanged(t *testing.T) {
+	parent := "parent"
+	child := "child"
+	parentRow := map[string]interface{}{
+		"children": libovsdb.OvsSet{GoSet: []interface{}{}},
+	}
+	req := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &parent,
+				Row:   &parentRow,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	/* an unreferenced row that the transaction doesn't dereference is not collected */
+	testEtcdPut(t, "refs", child, map[string]interface{}{"name": "orphan"})
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, int64(1), testEtcdCount(t, "refs", child))
+	assert.Equal(t, 1, len(txn.etcd.Events))
+	/* neither the child table nor the referrers of the parent table are fetched */
+	assert.Equal(t, 0, len(txn.etcd.If))
+}
+
+func TestTransactRefsFetchReferenced(t *testing.T) {
+	other := "other"
+	otherRow := map[string]interface{}{
+		"name": "other1",
+	}
+	req := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &other,
+				Row:   &otherRow,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "refs", "parent", map[string]interface{}{"peers": []interface{}{"set", []interface{}{}}})
+	/* the rows that refer to the other table are not fetched, the transaction doesn't conflict with them */
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 0, len(txn.cache.Table("refs", "parent")))
+	assert.Equal(t, 0, len(txn.etcd.If))
+}
+
+func TestTransactRefsWeakRemoval(t *testing.T) {
+	parent := "parent"
+	other := "other"
+	namedUUID := "other1"
+	otherRow := map[string]interface{}{
+		"name": "other1",
+	}
+	parentRow := map[string]interface{}{
+		"peers": libovsdb.OvsSet{GoSet: []interface{}{
+			libovsdb.UUID{GoUUID: namedUUID},
+		}},
+	}
+	req1 := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_INSERT,
+				Table:    &other,
+				Row:      &otherRow,
+				UUIDName: &namedUUID,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &parent,
+				Row:   &parentRow,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, _ := testTransact(t, req1)
+	assert.Nil(t, resp.Error)
+
+	req2 := &libovsdb.Transact{
+		DBName: "refs",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &other,
+			},
+		},
+	}
+	resp, txn := testTransact(t, req2)
 	assert.Nil(t, resp.Error)
-	dump := testEtcdDump(t, "set", "table1")
-	expected := []interface{}{
-		"set",
-		[]interface{}{
-			[]interface{}{"uuid", "00000000-0000-0000-0000-000000000001"},
-			[]interface{}{"uuid", "00000000-0000-0000-0000-000000000002"},
-		},
-	}
-	assert.Equal(t, expected, dump["uuid"])
+	assert.Equal(t, int64(0), testEtcdCount(t, "refs", "other"))
+	dump := testEtcdDump(t, "refs", "parent")
+	assert.Equal(t, []interface{}{"set", []interface{}{}}, dump["peers"])
+	/* delete of the other row and modify of the parent row */
+	assert.Equal(t, 2, len(txn.etcd.Events))
 }
 
-func TestTransactMutateUnmutableError(t *testing.T) {
-	table := "table1"
-	row := map[string]interface{}{
-		"mutable":   int(1),
-		"unmutable": int(1),
+func TestTransactRefsDeleteReferencedError(t *testing.T) {
+	parent := "parent"
+	other := "other"
+	namedUUID := "other1"
+	otherRow := map[string]interface{}{
+		"name": "other1",
 	}
-	mutations := []interface{}{
-		[]interface{}{
-			"mutable",
-			"+=",
-			int(1),
-		},
-		[]interface{}{
-			"unmutable",
-			"+=",
-			int(1),
-		},
+	parentRow := map[string]interface{}{
+		"owner": libovsdb.OvsSet{GoSet: []interface{}{
+			libovsdb.UUID{GoUUID: namedUUID},
+		}},
 	}
-	req := &libovsdb.Transact{
-		DBName: "mutable",
+	req1 := &libovsdb.Transact{
+		DBName: "refs",
 		Operations: []libovsdb.Operation{
 			{
-				Op:    OP_INSERT,
-				Table: &table,
-				Row:   &row,
+				Op:       OP_INSERT,
+				Table:    &other,
+				Row:      &otherRow,
+				UUIDName: &namedUUID,
 			},
 			{
-				Op:        OP_MUTATE,
-				Table:     &table,
-				Mutations: &mutations,
+				Op:    OP_INSERT,
+				Table: &parent,
+				Row:   &parentRow,
 			},
 		},
 	}
 	common.SetPrefix("ovsdb/nb")
 	testEtcdCleanup(t)
-	resp, _ := testTransact(t, req)
-	assert.NotNil(t, resp.Error)
-}
+	resp, _ := testTransact(t, req1)
+	assert.Nil(t, resp.Error)
 
-func TestTransactDelete(t *testing.T) {
-	table := "table1"
-	req := &libovsdb.Transact{
-		DBName: "simple",
+	req2 := &libovsdb.Transact{
+		DBName: "refs",
 		Operations: []libovsdb.Operation{
 			{
 				Op:    OP_DELETE,
-				Table: &table,
+				Table: &other,
 			},
 		},
 	}
-	common.SetPrefix("ovsdb/nb")
-	testEtcdCleanup(t)
-	testEtcdPut(t, "simple", "table1", map[string]interface{}{
-		"key1": "val1",
-		"key2": int(2),
-	})
-	resp, _ := testTransact(t, req)
-	assert.Nil(t, resp.Error)
-	dump := testEtcdDump(t, "simple", "table1")
-	_, ok := dump["key1"]
-	assert.False(t, ok)
+	resp, _ = testTransact(t, req2)
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, 2, len(resp.Result))
+	assert.Equal(t, E_INTEGRITY_VIOLATION, *resp.Result[1].Error)
+	assert.Equal(t, int64(1), testEtcdCount(t, "refs", "other"))
 }
 
 func TestTransactWaitSimpleEQ(t *testing.T) {
@@ -1379,6 +2545,111 @@ func testColumnDefault(t *testing.T, from interface{}) interface{} {
 	return to
 }
 
+func testTransactWaitBlocking(timeout int) *libovsdb.Transact {
+	table := "table1"
+	columns := []string{"key1"}
+	rows := []map[string]interface{}{
+		{
+			"key1": "val1",
+		},
+	}
+	until := FN_EQ
+	where := []interface{}{[]interface{}{"key1", FN_EQ, "val1"}}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:      OP_WAIT,
+				Table:   &table,
+				Where:   &where,
+				Rows:    &rows,
+				Columns: &columns,
+				Until:   &until,
+				Timeout: &timeout,
+			},
+		},
+	}
+	return req
+}
+
+func TestTransactWaitBlockingEQ(t *testing.T) {
+	req := testTransactWaitBlocking(5000)
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	txn := testNewTransaction(cli, req)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		testEtcdPut(t, "simple", "table1", map[string]interface{}{
+			"key1": "val1",
+		})
+	}()
+	start := time.Now()
+	_, err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Nil(t, txn.response.Error)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestTransactWaitBlockingTimeoutError(t *testing.T) {
+	req := testTransactWaitBlocking(300)
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	txn := testNewTransaction(cli, req)
+	go func() {
+		/* modification of another row doesn't satisfy the wait */
+		time.Sleep(100 * time.Millisecond)
+		testEtcdPut(t, "simple", "table1", map[string]interface{}{
+			"key1": "val2",
+		})
+	}()
+	start := time.Now()
+	_, err = txn.Commit()
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) >= 300*time.Millisecond)
+	assert.Equal(t, 1, len(txn.response.Result))
+	assert.Equal(t, E_TIMEOUT, *txn.response.Result[0].Error)
+}
+
+func TestTransactWaitBlockingCanceledError(t *testing.T) {
+	req := testTransactWaitBlocking(5000)
+	table := "table1"
+	row := map[string]interface{}{
+		"key1": "val2",
+	}
+	req.Operations = append(req.Operations, libovsdb.Operation{
+		Op:    OP_INSERT,
+		Table: &table,
+		Row:   &row,
+	})
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txn := NewTransaction(ctx, cli, klogr.New(), req)
+	txn.AddSchema(testSchemaSimple)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = txn.Commit()
+	assert.NotNil(t, err)
+	assert.Equal(t, E_CANCELED, err.Error())
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, E_CANCELED, *txn.response.Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+}
+
 func TestTransactWaitMapEQ(t *testing.T) {
 	table := "table1"
 	timeout := 0
@@ -1419,6 +2690,70 @@ func TestTransactWaitMapEQ(t *testing.T) {
 	assert.Nil(t, resp.Error)
 }
 
+func TestTransactDryRun(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{
+		"key1": "val1",
+	}
+	row2 := map[string]interface{}{
+		"key2": int(5),
+	}
+	where := []interface{}{
+		[]interface{}{"key1", FN_EQ, "val0"},
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+			},
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row2,
+				Where: &where,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	testEtcdPut(t, "simple", "table1", map[string]interface{}{
+		"key1": "val0",
+		"key2": int(3),
+	})
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	txn := testNewTransaction(cli, req)
+	txn.dryRun = true
+	_, err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Nil(t, txn.response.Error)
+	assert.NotNil(t, txn.response.Result[0].UUID)
+	assert.Equal(t, 1, *txn.response.Result[1].Count)
+
+	/* nothing is written */
+	assert.Equal(t, int64(1), testEtcdCount(t, "simple", "table1"))
+	dump := testEtcdDump(t, "simple", "table1")
+	assert.Equal(t, "val0", dump["key1"])
+	assert.Equal(t, float64(3), dump["key2"])
+
+	changes := dryRunChanges(txn.changes)
+	assert.Equal(t, 2, len(changes["table1"]))
+	inserted := changes["table1"][txn.response.Result[0].UUID.GoUUID]
+	assert.Nil(t, inserted.Old)
+	assert.Equal(t, "val1", (*inserted.New)["key1"])
+	for uuid, rowUpdate := range changes["table1"] {
+		if uuid == txn.response.Result[0].UUID.GoUUID {
+			continue
+		}
+		assert.Equal(t, 3, (*rowUpdate.Old)["key2"])
+		assert.Equal(t, 5, (*rowUpdate.New)["key2"])
+	}
+}
+
 func TestTransactCommit(t *testing.T) {
 	durable := true
 	req := &libovsdb.Transact{
@@ -1432,7 +2767,78 @@ func TestTransactCommit(t *testing.T) {
 	}
 	common.SetPrefix("ovsdb/nb")
 	resp, _ := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+}
+
+func TestTransactCommitDurableInsert(t *testing.T) {
+	table := "table1"
+	durable := true
+	row := map[string]interface{}{
+		"key1": "val1",
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+			{
+				Op:      OP_COMMIT,
+				Durable: &durable,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp, txn := testTransact(t, req)
+	assert.Nil(t, resp.Error)
+	assert.True(t, txn.durable)
+	assert.Equal(t, 2, len(resp.Result))
+	dump := testEtcdDump(t, "simple", "table1")
+	assert.Equal(t, "val1", dump["key1"])
+}
+
+func TestTransactCommitDurableMissingError(t *testing.T) {
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op: OP_COMMIT,
+			},
+		},
+	}
+	common.SetPrefix("ovsdb/nb")
+	resp, _ := testTransact(t, req)
 	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[0].Error)
+}
+
+func TestTransactCommitDurableCanceled(t *testing.T) {
+	table := "table1"
+	row := map[string]interface{}{
+		"key1": "val1",
+	}
+	req := &libovsdb.Transact{
+		DBName:     "simple",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	}
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	txn := NewTransaction(ctx, cli, klogr.New(), req)
+	txn.AddSchema(testSchemaSimple)
+	revision, err := txn.Commit()
+	assert.Nil(t, err)
+
+	/* the transaction is committed, its durability is confirmed even if it is canceled */
+	cancel()
+	assert.True(t, txn.confirmDurable(revision))
+	assert.Nil(t, txn.response.Error)
 }
 
 func TestTransactAbort(t *testing.T) {
@@ -1466,5 +2872,96 @@ func TestTransactComment(t *testing.T) {
 	assert.Nil(t, resp.Error)
 }
 
+func testTransactAssert(lockID string) *libovsdb.Transact {
+	table := "table1"
+	row := map[string]interface{}{
+		"key1": "val1",
+	}
+	return &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:   OP_ASSERT,
+				Lock: &lockID,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row,
+			},
+		},
+	}
+}
+
+func testTransactLock(t *testing.T, cli *clientv3.Client, lockID string) Locker {
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	myLock, err := db.GetLock(context.Background(), lockID)
+	assert.Nil(t, err)
+	return myLock
+}
+
 func TestTransactAssert(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	myLock := testTransactLock(t, cli, "lock1")
+	defer myLock.cancel()
+	assert.Nil(t, myLock.tryLock())
+
+	txn := testNewTransaction(cli, testTransactAssert("lock1"))
+	txn.locks["lock1"] = myLock
+	_, err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Nil(t, txn.response.Error)
+	assert.Equal(t, int64(1), testEtcdCount(t, "simple", "table1"))
+}
+
+func TestTransactAssertNotOwnerError(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	otherLock := testTransactLock(t, cli, "lock1")
+	defer otherLock.cancel()
+	assert.Nil(t, otherLock.tryLock())
+	myLock := testTransactLock(t, cli, "lock1")
+	defer myLock.cancel()
+	assert.Equal(t, concurrency.ErrLocked, myLock.tryLock())
+
+	txn := testNewTransaction(cli, testTransactAssert("lock1"))
+	txn.locks["lock1"] = myLock
+	_, err = txn.Commit()
+	assert.NotNil(t, err)
+	assert.Equal(t, E_NOT_OWNER, *txn.response.Result[0].Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+
+	/* a lock that was not requested by the client */
+	resp, _ := testTransact(t, testTransactAssert("lock2"))
+	assert.NotNil(t, resp.Error)
+	assert.Equal(t, E_NOT_OWNER, *resp.Result[0].Error)
+}
+
+func TestTransactAssertLockLostError(t *testing.T) {
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	myLock := testTransactLock(t, cli, "lock1")
+	defer myLock.cancel()
+	assert.Nil(t, myLock.tryLock())
+	/* the lock is lost, but the client wasn't notified yet */
+	_, err = cli.Delete(context.Background(), myLock.(*lock).mutex.Key())
+	assert.Nil(t, err)
+
+	txn := testNewTransaction(cli, testTransactAssert("lock1"))
+	txn.locks["lock1"] = myLock
+	_, err = txn.Commit()
+	assert.NotNil(t, err)
+	assert.Equal(t, E_NOT_OWNER, *txn.response.Result[0].Error)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
 }
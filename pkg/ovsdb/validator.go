@@ -0,0 +1,202 @@
+package ovsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// RowChange is a change of a row by a transaction, Old is nil for an inserted row and New is nil for a deleted row.
+// The rows are in their native form (see libovsdb.TableSchema.Unmarshal), after the named uuids were resolved.
+type RowChange struct {
+	UUID string
+	Old  map[string]interface{}
+	New  map[string]interface{}
+	// the index of the last operation that changed the row, or the number of the operations if the row was changed
+	// by the commit itself (e.g. the garbage collection of the unreferenced rows)
+	Operation int
+}
+
+// TableChanges are the row changes of a transaction, by table name
+type TableChanges map[string][]*RowChange
+
+// TransactionValidator validates the changes of a transaction before they are committed to etcd, to enforce policies
+// that the schema can't express.
+type TransactionValidator interface {
+	// Validate returns the errors of the invalid changes by operation index. The errors are reported to the client as
+	// "constraint violation" results of the operations, with the error messages as details.
+	Validate(dbName string, changes TableChanges) map[int]error
+}
+
+// TransactionValidatorFunc is an adapter to use a function as a TransactionValidator
+type TransactionValidatorFunc func(dbName string, changes TableChanges) map[int]error
+
+func (f TransactionValidatorFunc) Validate(dbName string, changes TableChanges) map[int]error {
+	return f(dbName, changes)
+}
+
+var (
+	validatorsMu      sync.RWMutex
+	validators        = map[string]TransactionValidator{}
+	enabledValidators []TransactionValidator
+)
+
+// RegisterTransactionValidator makes a validator available by name, it panics if the name is already registered.
+// A registered validator is not called until it is enabled by EnableTransactionValidators.
+func RegisterTransactionValidator(name string, validator TransactionValidator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	if validator == nil {
+		panic("RegisterTransactionValidator: validator is nil")
+	}
+	if _, ok := validators[name]; ok {
+		panic("RegisterTransactionValidator: called twice for validator " + name)
+	}
+	validators[name] = validator
+}
+
+// EnableTransactionValidators sets the validators, by their registered names, that validate the following
+// transactions.
+func EnableTransactionValidators(names []string) error {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	enabled := []TransactionValidator{}
+	for _, name := range names {
+		validator, ok := validators[name]
+		if !ok {
+			return fmt.Errorf("unknown transaction validator %q", name)
+		}
+		enabled = append(enabled, validator)
+	}
+	enabledValidators = enabled
+	return nil
+}
+
+func enabledTransactionValidators() []TransactionValidator {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	return enabledValidators
+}
+
+// validateChanges calls the validators with the changes of the transaction, opEvents are the numbers of the events
+// after each operation was executed. The first error is returned, all of them are reported as operation results.
+func (txn *Transaction) validateChanges(opEvents []int) error {
+	if len(txn.validators) == 0 || len(txn.etcd.Events) == 0 {
+		return nil
+	}
+	changes, err := txn.tableChanges(opEvents)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	var firstErr error
+	for _, validator := range txn.validators {
+		errs := validator.Validate(txn.request.DBName, changes)
+		ops := make([]int, 0, len(errs))
+		for i, err := range errs {
+			if err != nil {
+				ops = append(ops, i)
+			}
+		}
+		sort.Ints(ops)
+		for _, i := range ops {
+			if i < 0 || i > len(txn.request.Operations) {
+				err = errors.New(E_INTERNAL_ERROR)
+				txn.log.Error(err, "validator returned an error of unknown operation", "operation", i, "error", errs[i])
+				return err
+			}
+			err = newOvsdbError(E_CONSTRAINT_VIOLATION, "%s", errs[i].Error())
+			txn.log.Error(err, "transaction validation failed", "operation", i, "details", errorDetails(err))
+			txn.setOperationError(i, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return firstErr
+		}
+	}
+	return nil
+}
+
+// tableChanges returns the row changes of the transaction, a row that was changed by several operations is reported
+// once, with its value before the transaction and its final value.
+func (txn *Transaction) tableChanges(opEvents []int) (TableChanges, error) {
+	changes := TableChanges{}
+	rowChanges := map[string]*RowChange{}
+	op := 0
+	for i, ev := range txn.etcd.Events {
+		for op < len(opEvents) && i >= opEvents[op] {
+			op++
+		}
+		if ev == nil {
+			continue
+		}
+		key, err := common.ParseKey(etcdEventKey(ev))
+		if err != nil {
+			txn.log.Error(err, "parseKey failed")
+			return nil, errors.New(E_INTERNAL_ERROR)
+		}
+		tableSchema, err := txn.schemas.LookupTable(key.DBName, key.TableName)
+		if err != nil {
+			txn.log.Error(err, "missing table schema", "table", key.TableName)
+			return nil, errors.New(E_INTERNAL_ERROR)
+		}
+		change, ok := rowChanges[key.String()]
+		if !ok {
+			change = &RowChange{UUID: key.UUID}
+			if !etcdEventIsCreate(ev) {
+				if change.Old, err = validatorRow(tableSchema, ev.PrevKv.Value); err != nil {
+					txn.log.Error(err, "failed to unmarshal row", "key", key.ShortString())
+					return nil, errors.New(E_INTERNAL_ERROR)
+				}
+			}
+			rowChanges[key.String()] = change
+			changes[key.TableName] = append(changes[key.TableName], change)
+		}
+		change.Operation = op
+		change.New = nil
+		if ev.Type != mvccpb.DELETE {
+			if change.New, err = validatorRow(tableSchema, ev.Kv.Value); err != nil {
+				txn.log.Error(err, "failed to unmarshal row", "key", key.ShortString())
+				return nil, errors.New(E_INTERNAL_ERROR)
+			}
+		}
+	}
+	/* the rows that were inserted and deleted by the transaction are not changed */
+	for table, tableChanges := range changes {
+		filtered := tableChanges[:0]
+		for _, change := range tableChanges {
+			if change.Old != nil || change.New != nil {
+				filtered = append(filtered, change)
+			}
+		}
+		if len(filtered) == 0 {
+			delete(changes, table)
+		} else {
+			changes[table] = filtered
+		}
+	}
+	return changes, nil
+}
+
+// validatorRow returns the stored row in its native form
+func validatorRow(tableSchema *libovsdb.TableSchema, val []byte) (map[string]interface{}, error) {
+	row := map[string]interface{}{}
+	if err := json.Unmarshal(val, &row); err != nil {
+		return nil, err
+	}
+	if err := tableSchema.Unmarshal(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
@@ -0,0 +1,142 @@
+package ovsdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+func testValidatorTransact(t *testing.T, validator TransactionValidator, req *libovsdb.Transact) *libovsdb.TransactResponse {
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	txn := testNewTransaction(cli, req)
+	txn.validators = []TransactionValidator{validator}
+	txn.Commit()
+	return &txn.response
+}
+
+func TestValidatorRegister(t *testing.T) {
+	validator := TransactionValidatorFunc(func(dbName string, changes TableChanges) map[int]error {
+		return nil
+	})
+	RegisterTransactionValidator("test-register", validator)
+	assert.Panics(t, func() { RegisterTransactionValidator("test-register", validator) })
+	assert.NotNil(t, EnableTransactionValidators([]string{"test-register", "test-unknown"}))
+	assert.Equal(t, 0, len(enabledTransactionValidators()))
+	assert.Nil(t, EnableTransactionValidators([]string{"test-register"}))
+	assert.Equal(t, 1, len(enabledTransactionValidators()))
+	assert.Nil(t, EnableTransactionValidators(nil))
+}
+
+func TestValidatorInsertError(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{
+		"key1": "val1",
+	}
+	row2 := map[string]interface{}{
+		"key1": "bad",
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row1,
+			},
+			{
+				Op:    OP_INSERT,
+				Table: &table,
+				Row:   &row2,
+			},
+		},
+	}
+	validator := TransactionValidatorFunc(func(dbName string, changes TableChanges) map[int]error {
+		errs := map[int]error{}
+		for _, change := range changes["table1"] {
+			if change.New != nil && change.New["key1"] == "bad" {
+				errs[change.Operation] = errors.New("key1 is bad")
+			}
+		}
+		return errs
+	})
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp := testValidatorTransact(t, validator, req)
+	assert.NotNil(t, resp.Error)
+	assert.Nil(t, resp.Result[0].Error)
+	assert.Equal(t, E_CONSTRAINT_VIOLATION, *resp.Result[1].Error)
+	assert.Equal(t, "key1 is bad", *resp.Result[1].Details)
+	assert.Equal(t, int64(0), testEtcdCount(t, "simple", "table1"))
+}
+
+func TestValidatorChanges(t *testing.T) {
+	table := "table1"
+	row1 := map[string]interface{}{
+		"key1": "val1",
+	}
+	row2 := map[string]interface{}{
+		"key1": "val2",
+	}
+	uuidName := "row1"
+	where := []interface{}{
+		[]interface{}{COL_UUID, FN_EQ, []interface{}{"named-uuid", uuidName}},
+	}
+	req := &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:       OP_INSERT,
+				Table:    &table,
+				Row:      &row1,
+				UUIDName: &uuidName,
+			},
+			{
+				Op:    OP_UPDATE,
+				Table: &table,
+				Row:   &row2,
+				Where: &where,
+			},
+		},
+	}
+	var changes TableChanges
+	validator := TransactionValidatorFunc(func(dbName string, c TableChanges) map[int]error {
+		assert.Equal(t, "simple", dbName)
+		changes = c
+		return nil
+	})
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	resp := testValidatorTransact(t, validator, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 1, len(changes["table1"]))
+	change := changes["table1"][0]
+	assert.Equal(t, resp.Result[0].UUID.GoUUID, change.UUID)
+	assert.Equal(t, 1, change.Operation)
+	assert.Nil(t, change.Old)
+	assert.Equal(t, "val2", change.New["key1"])
+
+	req = &libovsdb.Transact{
+		DBName: "simple",
+		Operations: []libovsdb.Operation{
+			{
+				Op:    OP_DELETE,
+				Table: &table,
+				Where: &[]interface{}{},
+			},
+		},
+	}
+	changes = nil
+	resp = testValidatorTransact(t, validator, req)
+	assert.Nil(t, resp.Error)
+	assert.Equal(t, 1, len(changes["table1"]))
+	change = changes["table1"][0]
+	assert.Equal(t, 0, change.Operation)
+	assert.Equal(t, "val2", change.Old["key1"])
+	assert.Nil(t, change.New)
+}
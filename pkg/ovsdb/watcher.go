@@ -0,0 +1,242 @@
+package ovsdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+)
+
+// the number of the watch responses that are queued for a monitor, a monitor that falls further behind is canceled,
+// so the shared watch never waits for it
+var monitorEventsBuffer = 100
+
+// monitorRow is a stored row of an etcd event or of a range response. It is decoded once for all the updaters of all
+// the monitors, which run in the goroutines of their connections, so the decoded values are never modified.
+type monitorRow struct {
+	kv *mvccpb.KeyValue
+
+	dataOnce sync.Once
+	uuid     string
+	data     map[string]interface{}
+	dataErr  error
+
+	nativeOnce sync.Once
+	native     map[string]interface{}
+	nativeErr  error
+}
+
+func newMonitorRow(kv *mvccpb.KeyValue) *monitorRow {
+	return &monitorRow{kv: kv}
+}
+
+// decode returns the stored columns of the row and its uuid
+func (r *monitorRow) decode() (map[string]interface{}, string, error) {
+	r.dataOnce.Do(func() {
+		if r.data, r.dataErr = unmarshalStoredRow(r.kv.Value); r.dataErr != nil {
+			return
+		}
+		r.uuid, r.dataErr = keyUUID(r.kv.Key)
+	})
+	return r.data, r.uuid, r.dataErr
+}
+
+// nativeRow returns the row that is decoded by the table schema, with its _uuid and _version columns, as the where
+// conditions expect it. All the updaters of a table have the same schema.
+func (r *monitorRow) nativeRow(tableSchema *libovsdb.TableSchema) (map[string]interface{}, error) {
+	r.nativeOnce.Do(func() {
+		_, uuid, err := r.decode()
+		if err != nil {
+			r.nativeErr = err
+			return
+		}
+		row, err := unmarshalData(r.kv.Value)
+		if err != nil {
+			r.nativeErr = err
+			return
+		}
+		tableSchema.Default(&row)
+		if err = tableSchema.Unmarshal(&row); err != nil {
+			r.nativeErr = err
+			return
+		}
+		row[COL_UUID] = libovsdb.UUID{GoUUID: uuid}
+		setRowVersion(&row, r.kv.ModRevision)
+		r.native = row
+	})
+	return r.native, r.nativeErr
+}
+
+// monitorEvent is an etcd event of a row with its decoded values, the row is nil for a delete event and the previous
+// row is nil for a create event
+type monitorEvent struct {
+	*clientv3.Event
+	key     common.Key
+	row     *monitorRow
+	prevRow *monitorRow
+}
+
+func newMonitorEvent(ev *clientv3.Event) *monitorEvent {
+	mev := &monitorEvent{Event: ev}
+	if ev.Type == mvccpb.PUT {
+		mev.row = newMonitorRow(ev.Kv)
+	}
+	if ev.PrevKv != nil {
+		mev.prevRow = newMonitorRow(ev.PrevKv)
+	}
+	return mev
+}
+
+// decodeEvents returns the events of the rows, the events without a valid row key are skipped
+func decodeEvents(events []*clientv3.Event, log logr.Logger) []*monitorEvent {
+	mevents := []*monitorEvent{}
+	for _, ev := range events {
+		if ev.Kv == nil {
+			log.V(5).Info("empty etcd event", "event", fmt.Sprintf("%+v", ev))
+			continue
+		}
+		key, err := common.ParseKey(string(ev.Kv.Key))
+		if err != nil {
+			log.Error(err, "parseKey failed")
+			continue
+		}
+		mev := newMonitorEvent(ev)
+		mev.key = *key
+		mevents = append(mevents, mev)
+	}
+	return mevents
+}
+
+// monitorEvents are the decoded events of a watch response
+type monitorEvents struct {
+	events   []*monitorEvent
+	revision int64
+	// the watch was canceled, the monitors are canceled as well
+	canceled bool
+}
+
+type watchSubscription struct {
+	events chan *monitorEvents
+	done   chan struct{}
+	// closed when the events buffer of the monitor is full, the monitor missed events, so it is canceled
+	overflow   chan struct{}
+	overflowed bool
+}
+
+// dbWatcher is the etcd watch of a database that is shared by the monitors of all the connections of the server. The
+// events of every watch response are decoded once and passed to the queues of the monitors, which prepare the updates
+// of their connections concurrently.
+type dbWatcher struct {
+	log    logr.Logger
+	dbName string
+	cancel context.CancelFunc
+	// called when the last monitor unsubscribes, or the watch is canceled
+	remove func(w *dbWatcher)
+
+	mu            sync.Mutex
+	subscriptions map[*dbMonitor]*watchSubscription
+	stopped       bool
+}
+
+func newDbWatcher(cli *clientv3.Client, dbName string, log logr.Logger, remove func(w *dbWatcher)) *dbWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &dbWatcher{
+		log:           log.WithValues("watch", dbName),
+		dbName:        dbName,
+		cancel:        cancel,
+		remove:        remove,
+		subscriptions: map[*dbMonitor]*watchSubscription{},
+	}
+	key := common.NewDBPrefixKey(dbName)
+	wch := cli.Watch(clientv3.WithRequireLeader(ctx), key.String(),
+		clientv3.WithPrefix(),
+		clientv3.WithCreatedNotify(),
+		clientv3.WithPrevKV())
+	go w.run(wch)
+	return w
+}
+
+// subscribe adds the monitor to the watch, it receives the events of the watch responses that arrive from now on. It
+// returns false if the watch was stopped.
+func (w *dbWatcher) subscribe(m *dbMonitor) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return false
+	}
+	s := &watchSubscription{events: make(chan *monitorEvents, monitorEventsBuffer), done: make(chan struct{}),
+		overflow: make(chan struct{})}
+	w.subscriptions[m] = s
+	m.watchChannel = s.events
+	m.watchDone = s.done
+	m.watchOverflow = s.overflow
+	m.cancel = func() { w.unsubscribe(m) }
+	return true
+}
+
+// unsubscribe removes the monitor from the watch, the watch is stopped after its last monitor is removed
+func (w *dbWatcher) unsubscribe(m *dbMonitor) {
+	w.mu.Lock()
+	s, ok := w.subscriptions[m]
+	if ok {
+		delete(w.subscriptions, m)
+		close(s.done)
+	}
+	stop := len(w.subscriptions) == 0 && !w.stopped
+	if stop {
+		w.stopped = true
+	}
+	w.mu.Unlock()
+	if stop {
+		w.log.V(5).Info("stop watch")
+		w.cancel()
+		w.remove(w)
+	}
+}
+
+func (w *dbWatcher) run(wch clientv3.WatchChan) {
+	for wresp := range wch {
+		if wresp.Canceled {
+			w.log.Info("watch canceled", "reason", wresp.Err())
+			break
+		}
+		if len(wresp.Events) == 0 {
+			continue
+		}
+		w.dispatch(&monitorEvents{events: decodeEvents(wresp.Events, w.log), revision: wresp.Header.Revision})
+	}
+	w.mu.Lock()
+	stopped := w.stopped
+	w.stopped = true
+	w.mu.Unlock()
+	if !stopped {
+		/* the monitors can't miss events, they are canceled, and the next monitors start a new watch */
+		w.remove(w)
+		w.dispatch(&monitorEvents{canceled: true})
+	}
+}
+
+// dispatch passes the events to the monitors without waiting for them, a monitor whose buffer is full stops receiving
+// events until it unsubscribes, and is canceled
+func (w *dbWatcher) dispatch(events *monitorEvents) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range w.subscriptions {
+		if s.overflowed {
+			continue
+		}
+		select {
+		case s.events <- events:
+		default:
+			w.log.Info("monitor events buffer is full, cancel monitor", "buffer", monitorEventsBuffer)
+			s.overflowed = true
+			close(s.overflow)
+		}
+	}
+}
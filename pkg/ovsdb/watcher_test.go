@@ -0,0 +1,141 @@
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	klogr "k8s.io/klog/v2/klogr"
+
+	"github.com/ibm/ovsdb-etcd/pkg/common"
+	"github.com/ibm/ovsdb-etcd/pkg/libovsdb"
+	"github.com/ibm/ovsdb-etcd/pkg/ovsjson"
+)
+
+func TestWatcherShared(t *testing.T) {
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	/* two connections monitor the same database */
+	handlers := []*Handler{}
+	for _, jsonValue := range []string{"monid1", "monid2"} {
+		handler := NewHandler(ctx, db, cli, klogr.New())
+		params := []interface{}{"simple", jsonValue, map[string]interface{}{table: []interface{}{map[string]interface{}{}}}}
+		updatersMap, err := handler.addMonitor(params, ovsjson.Update2)
+		assert.Nil(t, err)
+		_, err = handler.getMonitoredData("simple", updatersMap)
+		assert.Nil(t, err)
+		handlers = append(handlers, handler)
+	}
+	watchers := db.(*DatabaseEtcd).watchers
+	assert.Equal(t, 1, len(watchers))
+	assert.Equal(t, 2, len(watchers["simple"].subscriptions))
+
+	row := map[string]interface{}{"key1": "val1"}
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName:     "simple",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	})
+	assert.Nil(t, resp.Error)
+	uuid := resp.Result[0].UUID.GoUUID
+	for i, handler := range handlers {
+		jsonValue := []string{"monid1", "monid2"}[i]
+		popCtx, popCancel := context.WithTimeout(ctx, 5*time.Second)
+		event, state := handler.handlerMonitorData[jsonValue].notifications.pop(popCtx)
+		popCancel()
+		if !assert.Equal(t, queueOpen, state, "missing notification of %s", jsonValue) {
+			continue
+		}
+		assert.Equal(t, jsonValue, event.jsonValue)
+		rowUpdate := event.updates[table][uuid]
+		assert.NotNil(t, rowUpdate.Insert)
+		assert.Equal(t, "val1", (*rowUpdate.Insert)["key1"])
+	}
+
+	/* the watch is stopped after the last monitor is removed */
+	assert.Nil(t, handlers[0].removeMonitor("monid1", false))
+	assert.Equal(t, 1, len(db.(*DatabaseEtcd).watchers))
+	assert.Nil(t, handlers[1].removeMonitor("monid2", false))
+	assert.Equal(t, 0, len(db.(*DatabaseEtcd).watchers))
+}
+
+func TestWatcherOverflow(t *testing.T) {
+	defer func(buffer int) { monitorEventsBuffer = buffer }(monitorEventsBuffer)
+	monitorEventsBuffer = 1
+	table := "table1"
+	common.SetPrefix("ovsdb/nb")
+	testEtcdCleanup(t)
+	cli, err := testEtcdNewCli()
+	assert.Nil(t, err)
+	defer cli.Close()
+	db, err := NewDatabaseEtcd(cli)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := NewHandler(ctx, db, cli, klogr.New())
+	params := []interface{}{"simple", "monid", map[string]interface{}{table: []interface{}{map[string]interface{}{}}}}
+	updatersMap, err := handler.addMonitor(params, ovsjson.Update2)
+	assert.Nil(t, err)
+	_, err = handler.getMonitoredData("simple", updatersMap)
+	assert.Nil(t, err)
+	expMsg, err := json.Marshal("monid")
+	assert.Nil(t, err)
+	handler.SetConnection(&jrpcServerMock{expMethod: MONITOR_CANCELED, expMessage: expMsg, t: t}, nil)
+
+	/* the monitor doesn't read the events, the watch doesn't wait for it */
+	watcher := db.(*DatabaseEtcd).watchers["simple"]
+	monitor := handler.monitors["simple"]
+	monitor.mu.Lock()
+	for revision := int64(1); revision <= 3; revision++ {
+		watcher.dispatch(&monitorEvents{revision: revision})
+	}
+	watcher.mu.Lock()
+	assert.True(t, watcher.subscriptions[monitor].overflowed)
+	watcher.mu.Unlock()
+	monitor.mu.Unlock()
+
+	/* the monitor is canceled and removed, and the watch is stopped */
+	canceled := false
+	for i := 0; i < 50 && !canceled; i++ {
+		time.Sleep(100 * time.Millisecond)
+		handler.mu.Lock()
+		_, ok := handler.handlerMonitorData["monid"]
+		canceled = !ok && len(handler.monitors) == 0
+		handler.mu.Unlock()
+	}
+	assert.True(t, canceled)
+	watcher.mu.Lock()
+	assert.True(t, watcher.stopped)
+	watcher.mu.Unlock()
+
+	/* the client can monitor again with the same json-value */
+	updatersMap, err = handler.addMonitor(params, ovsjson.Update2)
+	assert.Nil(t, err)
+	_, err = handler.getMonitoredData("simple", updatersMap)
+	assert.Nil(t, err)
+	row := map[string]interface{}{"key1": "val1"}
+	resp, _ := testTransact(t, &libovsdb.Transact{
+		DBName:     "simple",
+		Operations: []libovsdb.Operation{{Op: OP_INSERT, Table: &table, Row: &row}},
+	})
+	assert.Nil(t, resp.Error)
+	uuid := resp.Result[0].UUID.GoUUID
+	popCtx, popCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer popCancel()
+	event, state := handler.handlerMonitorData["monid"].notifications.pop(popCtx)
+	if assert.Equal(t, queueOpen, state, "missing notification of the new monitor") {
+		rowUpdate := event.updates[table][uuid]
+		assert.NotNil(t, rowUpdate.Insert)
+		assert.Equal(t, "val1", (*rowUpdate.Insert)["key1"])
+	}
+}